@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Audit annotation keys. The API server prefixes them with the webhook name,
+// so each must be a valid qualified name segment: at most 63 alphanumerics, '-', '_' or '.'.
+const (
+	auditKeyRule             = "rule"
+	auditKeyAction           = "action"
+	auditKeyTolerationsAdded = "tolerations-added"
+	auditKeyPolicyHash       = "policy-hash"
+)
+
+// auditAnnotations returns the audit annotations of an admission decision:
+// the matched rule, the action taken, the tolerations added and the policy hash.
+// Empty rules and toleration lists are left out.
+func auditAnnotations(rule, action string, added []corev1.Toleration) map[string]string {
+	annotations := map[string]string{
+		auditKeyAction:     action,
+		auditKeyPolicyHash: policyHash(),
+	}
+	if rule != "" {
+		annotations[auditKeyRule] = rule
+	}
+	if len(added) > 0 {
+		tolerations, _ := json.Marshal(added)
+		annotations[auditKeyTolerationsAdded] = string(tolerations)
+	}
+	return annotations
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// TestAuditAnnotations tests the audit annotations of each action and that their keys are accepted by the API server.
+func TestAuditAnnotations(t *testing.T) {
+	testCases := []struct {
+		description  string
+		rule         string
+		action       string
+		added        []corev1.Toleration
+		expectedKeys []string
+	}{
+		{"mutated", toleration.Key, decisionMutated, []corev1.Toleration{toleration}, []string{auditKeyAction, auditKeyPolicyHash, auditKeyRule, auditKeyTolerationsAdded}},
+		{"unchanged", toleration.Key, decisionUnchanged, nil, []string{auditKeyAction, auditKeyPolicyHash, auditKeyRule}},
+		{"ignored", "", decisionIgnored, nil, []string{auditKeyAction, auditKeyPolicyHash}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			annotations := auditAnnotations(testCase.rule, testCase.action, testCase.added)
+			if len(annotations) != len(testCase.expectedKeys) {
+				t.Errorf("Expected keys %v, got %v", testCase.expectedKeys, annotations)
+			}
+			for _, key := range testCase.expectedKeys {
+				if _, ok := annotations[key]; !ok {
+					t.Errorf("Expected key %s, got %v", key, annotations)
+				}
+				// The API server stores the annotation as <webhook name>/<key>.
+				if errs := validation.IsQualifiedName("toleration-webhook.toleration-webhook.svc/" + key); len(errs) > 0 {
+					t.Errorf("Invalid audit annotation key %s: %v", key, errs)
+				}
+			}
+			if annotations[auditKeyAction] != testCase.action {
+				t.Errorf("Expected action %s, got %s", testCase.action, annotations[auditKeyAction])
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Output formats of the audit subcommand.
+const (
+	auditOutputTable = "table"
+	auditOutputJSON  = "json"
+	auditOutputCSV   = "csv"
+	auditOutputJUnit = "junit"
+)
+
+// auditChangesExitCode is the exit code of the audit subcommand with --failOnChange when workloads would change.
+const auditChangesExitCode = 3
+
+// auditClient returns the clientset the audit subcommand lists workloads with. Tests swap it for a fake clientset.
+var auditClient = newKubernetesClient
+
+// auditEntry is the policy evaluation of a workload in the cluster.
+type auditEntry struct {
+	Namespace string          `json:"namespace"`
+	Kind      string          `json:"kind"`
+	Name      string          `json:"name"`
+	Action    string          `json:"action"`
+	Patch     json.RawMessage `json:"patch,omitempty"`
+}
+
+// buildAuditReport evaluates the policy against every supported workload matching objectSelector in the namespaces matching
+// namespaceSelector, restricted to the given namespace names when any, as the webhook would on their next update.
+func buildAuditReport(ctx context.Context, client kubernetes.Interface, namespaceSelector, objectSelector string, namespaceNames []string) ([]auditEntry, error) {
+	if _, err := labels.Parse(namespaceSelector); err != nil {
+		return nil, fmt.Errorf("invalid namespace selector %q: %s", namespaceSelector, err.Error())
+	}
+	if _, err := labels.Parse(objectSelector); err != nil {
+		return nil, fmt.Errorf("invalid object selector %q: %s", objectSelector, err.Error())
+	}
+
+	namespaceList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: namespaceSelector})
+	if err != nil {
+		return nil, fmt.Errorf("could not list namespaces: %s", err.Error())
+	}
+	selected := map[string]bool{}
+	for _, name := range namespaceNames {
+		selected[name] = true
+	}
+
+	var entries []auditEntry
+	for _, namespace := range namespaceList.Items {
+		if len(selected) > 0 && !selected[namespace.Name] {
+			continue
+		}
+		for _, supported := range supportedKinds {
+			objects, err := listWorkloads(ctx, client, supported.kind, namespace.Name, objectSelector)
+			if err != nil {
+				return nil, fmt.Errorf("could not list %s in %s: %s", supported.resource, namespace.Name, err.Error())
+			}
+			for _, object := range objects {
+				raw, err := json.Marshal(object)
+				if err != nil {
+					return nil, err
+				}
+				m, err := mutateManifest(raw, toleration)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, auditEntry{Namespace: m.Namespace, Kind: m.Kind, Name: m.Name, Action: m.Action, Patch: m.Patch})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return entries, nil
+}
+
+// listWorkloads lists the objects of the supported kind in namespace matching objectSelector, with their kind set.
+func listWorkloads(ctx context.Context, client kubernetes.Interface, kind, namespace, objectSelector string) ([]runtime.Object, error) {
+	options := metav1.ListOptions{LabelSelector: objectSelector}
+	typeMeta := metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: kind}
+	var objects []runtime.Object
+	switch kind {
+	case "Deployment":
+		list, err := client.AppsV1().Deployments(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			list.Items[i].TypeMeta = typeMeta
+			objects = append(objects, &list.Items[i])
+		}
+	case "DaemonSet":
+		list, err := client.AppsV1().DaemonSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			list.Items[i].TypeMeta = typeMeta
+			objects = append(objects, &list.Items[i])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+	return objects, nil
+}
+
+// runAudit implements the audit subcommand: it lists the supported workloads of the selected namespaces of a cluster
+// and writes the policy evaluation of each as a table, JSON, CSV or JUnit XML.
+func runAudit(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	kubeconfig := fs.String("kubeconfig", "", "Kubeconfig file, the in-cluster config is used when empty.")
+	namespaceSelector := fs.String("namespaceSelector", "", "Label selector of the namespaces to audit, all namespaces when empty.")
+	namespaces := fs.String("namespaces", "", "Comma-separated namespaces to audit, all namespaces matching --namespaceSelector when empty.")
+	objectSelector := fs.String("objectSelector", "", "Label selector of the workloads to audit.")
+	output := fs.String("output", auditOutputTable, "Output: table, json, csv or junit.")
+	failOnChange := fs.Bool("failOnChange", false, fmt.Sprintf("Exit with code %d when any workload would be mutated.", auditChangesExitCode))
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: webhook audit [--kubeconfig=FILE] [--namespaceSelector=SELECTOR] [--namespaces=NS,...] [--output=table|json|csv|junit]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	switch *output {
+	case auditOutputTable, auditOutputJSON, auditOutputCSV, auditOutputJUnit:
+	default:
+		fmt.Fprintf(stderr, "invalid output %q\n", *output)
+		return 2
+	}
+
+	client, err := auditClient(*kubeconfig)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	var namespaceNames []string
+	if *namespaces != "" {
+		namespaceNames = strings.Split(*namespaces, ",")
+	}
+	entries, err := buildAuditReport(context.Background(), client, *namespaceSelector, *objectSelector, namespaceNames)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := writeAuditReport(stdout, *output, entries); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if *failOnChange {
+		for _, entry := range entries {
+			if entry.Action == decisionMutated {
+				return auditChangesExitCode
+			}
+		}
+	}
+	return 0
+}
+
+// writeAuditReport writes entries to w in the given output format.
+func writeAuditReport(w io.Writer, output string, entries []auditEntry) error {
+	switch output {
+	case auditOutputJSON:
+		if entries == nil {
+			entries = []auditEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+
+	case auditOutputCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"namespace", "kind", "name", "action", "patch"})
+		for _, entry := range entries {
+			writer.Write([]string{entry.Namespace, entry.Kind, entry.Name, entry.Action, string(entry.Patch)})
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case auditOutputJUnit:
+		return writeJUnitReport(w, entries)
+
+	default:
+		writer := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAMESPACE\tKIND\tNAME\tACTION")
+		for _, entry := range entries {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", entry.Namespace, entry.Kind, entry.Name, entry.Action)
+		}
+		return writer.Flush()
+	}
+}
+
+// JUnit XML elements of the report, a test case per workload failing when it would be mutated.
+type (
+	junitTestSuites struct {
+		XMLName xml.Name         `xml:"testsuites"`
+		Suites  []junitTestSuite `xml:"testsuite"`
+	}
+	junitTestSuite struct {
+		Name     string          `xml:"name,attr"`
+		Tests    int             `xml:"tests,attr"`
+		Failures int             `xml:"failures,attr"`
+		Cases    []junitTestCase `xml:"testcase"`
+	}
+	junitTestCase struct {
+		ClassName string        `xml:"classname,attr"`
+		Name      string        `xml:"name,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// writeJUnitReport writes entries to w as JUnit XML with a test suite per namespace.
+func writeJUnitReport(w io.Writer, entries []auditEntry) error {
+	report := junitTestSuites{}
+	for _, entry := range entries {
+		if len(report.Suites) == 0 || report.Suites[len(report.Suites)-1].Name != entry.Namespace {
+			report.Suites = append(report.Suites, junitTestSuite{Name: entry.Namespace})
+		}
+		suite := &report.Suites[len(report.Suites)-1]
+		testCase := junitTestCase{ClassName: entry.Namespace, Name: entry.Kind + "/" + entry.Name}
+		if entry.Action == decisionMutated {
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%s %s/%s would be mutated: added toleration %s", entry.Kind, entry.Namespace, entry.Name, toleration.Key),
+				Text:    string(entry.Patch),
+			}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newAuditClientset returns a fake clientset with workloads in an enabled and a disabled namespace.
+func newAuditClientset() *fake.Clientset {
+	return fake.NewSimpleClientset(
+		testNamespace("foo", map[string]string{"team": "a"}),
+		testNamespace("bar", nil),
+		testDeployment(metav1.ObjectMeta{Name: "dep-a", Namespace: "foo"}),
+		testDeployment(metav1.ObjectMeta{Name: "dep-b", Namespace: "foo", Labels: map[string]string{"skip": "true"}}, toleration),
+		testDaemonSet(metav1.ObjectMeta{Name: "ds-a", Namespace: "foo"}, toleration),
+		testDeployment(metav1.ObjectMeta{Name: "dep-c", Namespace: "bar"}),
+	)
+}
+
+// TestBuildAuditReport tests workloads are listed from the selected namespaces and evaluated against the policy.
+func TestBuildAuditReport(t *testing.T) {
+	testCases := []struct {
+		description       string
+		namespaceSelector string
+		objectSelector    string
+		namespaces        []string
+		expected          []string
+	}{
+		{"all namespaces", "", "", nil, []string{"bar/Deployment/dep-c/mutated", "foo/DaemonSet/ds-a/unchanged", "foo/Deployment/dep-a/mutated", "foo/Deployment/dep-b/unchanged"}},
+		{"namespace selector", "team=a", "", nil, []string{"foo/DaemonSet/ds-a/unchanged", "foo/Deployment/dep-a/mutated", "foo/Deployment/dep-b/unchanged"}},
+		{"namespace names", "", "", []string{"bar"}, []string{"bar/Deployment/dep-c/mutated"}},
+		{"object selector", "team=a", "skip!=true", nil, []string{"foo/DaemonSet/ds-a/unchanged", "foo/Deployment/dep-a/mutated"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			entries, err := buildAuditReport(context.Background(), newAuditClientset(), testCase.namespaceSelector, testCase.objectSelector, testCase.namespaces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, strings.Join([]string{entry.Namespace, entry.Kind, entry.Name, entry.Action}, "/"))
+				if (entry.Action == decisionMutated) != (entry.Patch != nil) {
+					t.Errorf("Expected a patch for mutated workloads only, got %+v", entry)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(testCase.expected, ",") {
+				t.Errorf("Expected %v, got %v", testCase.expected, got)
+			}
+		})
+	}
+
+	if _, err := buildAuditReport(context.Background(), newAuditClientset(), "team in (", "", nil); err == nil {
+		t.Error("Expected an invalid namespace selector to fail")
+	}
+}
+
+// TestRunAudit tests the audit output formats and the --failOnChange exit code.
+func TestRunAudit(t *testing.T) {
+	previous := auditClient
+	auditClient = func(string) (kubernetes.Interface, error) { return newAuditClientset(), nil }
+	t.Cleanup(func() { auditClient = previous })
+
+	testCases := []struct {
+		description  string
+		args         []string
+		expectedCode int
+		check        func(t *testing.T, output string)
+	}{
+		{
+			description: "table",
+			args:        []string{"--namespaces=foo"},
+			check: func(t *testing.T, output string) {
+				expected := "NAMESPACE  KIND        NAME   ACTION\n" +
+					"foo        DaemonSet   ds-a   unchanged\n" +
+					"foo        Deployment  dep-a  mutated\n" +
+					"foo        Deployment  dep-b  unchanged\n"
+				if output != expected {
+					t.Errorf("Expected table\n%s\ngot\n%s", expected, output)
+				}
+			},
+		},
+		{
+			description: "json",
+			args:        []string{"--output=json", "--namespaces=bar"},
+			check: func(t *testing.T, output string) {
+				var entries []auditEntry
+				if err := json.Unmarshal([]byte(output), &entries); err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 1 || entries[0].Name != "dep-c" || entries[0].Action != decisionMutated {
+					t.Errorf("Unexpected entries %+v", entries)
+				}
+			},
+		},
+		{
+			description: "csv",
+			args:        []string{"--output=csv", "--namespaceSelector=team=a", "--objectSelector=skip=true"},
+			check: func(t *testing.T, output string) {
+				expected := "namespace,kind,name,action,patch\nfoo,Deployment,dep-b,unchanged,\n"
+				if output != expected {
+					t.Errorf("Expected csv %q, got %q", expected, output)
+				}
+			},
+		},
+		{
+			description:  "junit failing on change",
+			args:         []string{"--output=junit", "--failOnChange"},
+			expectedCode: auditChangesExitCode,
+			check: func(t *testing.T, output string) {
+				var report junitTestSuites
+				if err := xml.Unmarshal([]byte(output), &report); err != nil {
+					t.Fatal(err)
+				}
+				if len(report.Suites) != 2 || report.Suites[0].Name != "bar" || report.Suites[1].Tests != 3 || report.Suites[1].Failures != 1 {
+					t.Fatalf("Unexpected test suites %+v", report.Suites)
+				}
+				failure := report.Suites[1].Cases[1].Failure
+				if failure == nil || failure.Message != "Deployment foo/dep-a would be mutated: added toleration SimulateNodeFailure" {
+					t.Errorf("Unexpected failure %+v", failure)
+				}
+			},
+		},
+		{
+			description: "no change",
+			args:        []string{"--failOnChange", "--objectSelector=skip=true"},
+		},
+		{
+			description:  "invalid output",
+			args:         []string{"--output=yaml"},
+			expectedCode: 2,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runAudit(testCase.args, nil, &stdout, &stderr); code != testCase.expectedCode {
+				t.Fatalf("Expected exit code %d, got %d: %s", testCase.expectedCode, code, stderr.String())
+			}
+			if testCase.check != nil {
+				testCase.check(t, stdout.String())
+			}
+		})
+	}
+}
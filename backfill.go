@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// Results of the workloads the backfill controller found missing the toleration.
+const (
+	backfillPatched  = "patched"  // the workload was patched
+	backfillDryRun   = "dry_run"  // the patch was only sent as a dry run
+	backfillDeferred = "deferred" // the maintenance window was closed, the workload is patched on a later pass
+	backfillFailed   = "failed"   // the patch failed, it is retried on the next pass
+)
+
+// maintenanceWindow is a daily UTC time range, as offsets from midnight, the backfill controller patches workloads in.
+// The range wraps around midnight when end is before start.
+type maintenanceWindow struct {
+	start, end time.Duration
+}
+
+// parseMaintenanceWindow parses a HH:MM-HH:MM UTC time range. An empty window is always open and returned as nil.
+func parseMaintenanceWindow(window string) (*maintenanceWindow, error) {
+	if window == "" {
+		return nil, nil
+	}
+	start, end, ok := strings.Cut(window, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid maintenance window %q: must be HH:MM-HH:MM", window)
+	}
+	var w maintenanceWindow
+	for _, bound := range []struct {
+		value  string
+		offset *time.Duration
+	}{{start, &w.start}, {end, &w.end}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(bound.value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %s", window, err.Error())
+		}
+		*bound.offset = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("invalid maintenance window %q: start and end must differ", window)
+	}
+	return &w, nil
+}
+
+// contains returns whether t falls in the window. A nil window always contains t.
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	t = t.UTC()
+	offset := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// backfillController adds the toleration to workloads that existed before the webhook, or were admitted while it failed open,
+// in the namespaces matching the namespace selector. Patches are rate limited since each one rolls out the workload.
+type backfillController struct {
+	client            kubernetes.Interface
+	namespaceSelector string
+	objectSelector    string
+	dryRun            bool
+	window            *maintenanceWindow
+	limiter           flowcontrol.RateLimiter
+	now               func() time.Time
+}
+
+// newBackfillController returns a backfill controller for the namespaces and objects selected by parameters.
+func newBackfillController(client kubernetes.Interface, parameters serverParameters) (*backfillController, error) {
+	window, err := parseMaintenanceWindow(parameters.backfillWindow)
+	if err != nil {
+		return nil, err
+	}
+	return &backfillController{
+		client:            client,
+		namespaceSelector: parameters.namespaceSelector,
+		objectSelector:    parameters.objectSelector,
+		dryRun:            parameters.backfillDryRun,
+		window:            window,
+		limiter:           flowcontrol.NewTokenBucketRateLimiter(float32(parameters.backfillQPS), 1),
+		now:               time.Now,
+	}, nil
+}
+
+// run reconciles the selected workloads every interval until ctx is done.
+func (c *backfillController) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.reconcile(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Backfill failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile patches every selected workload missing the toleration with the patch the webhook would return for it.
+// Failed patches are counted and retried on the next pass, the pass ends at the first patch deferred by the maintenance window.
+func (c *backfillController) reconcile(ctx context.Context) error {
+	namespaces, err := c.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: c.namespaceSelector})
+	if err != nil {
+		return fmt.Errorf("could not list namespaces: %s", err.Error())
+	}
+	for _, namespace := range namespaces.Items {
+		for _, supported := range supportedKinds {
+			objects, err := listWorkloads(ctx, c.client, supported.kind, namespace.Name, c.objectSelector)
+			if err != nil {
+				return fmt.Errorf("could not list %s in %s: %s", supported.resource, namespace.Name, err.Error())
+			}
+			for _, object := range objects {
+				if tolerationExists(object, toleration) {
+					continue
+				}
+				result := c.patch(ctx, supported.kind, object)
+				RecordBackfill(supported.kind, result)
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				// A deferred patch means the maintenance window closed, the rest of the pass waits for the next one.
+				if result == backfillDeferred {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// patch adds the toleration to object and returns the backfill result.
+// The patch only applies to the resource version that was evaluated, so concurrent updates are not overwritten.
+func (c *backfillController) patch(ctx context.Context, kind string, object runtime.Object) string {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return backfillFailed
+	}
+	logger := slog.With("kind", kind, "namespace", accessor.GetNamespace(), "name", accessor.GetName(), "dryRun", c.dryRun)
+	if !c.window.contains(c.now()) {
+		logger.Debug("Maintenance window closed, deferring backfill")
+		return backfillDeferred
+	}
+
+	patchBytes, err := buildJsonPatch(object, toleration)
+	if err != nil {
+		logger.Error("Could not build backfill patch", "error", err)
+		return backfillFailed
+	}
+	var patch []patchOperation
+	if err := json.Unmarshal(patchBytes, &patch); err != nil {
+		logger.Error("Could not build backfill patch", "error", err)
+		return backfillFailed
+	}
+	if resourceVersion := accessor.GetResourceVersion(); resourceVersion != "" {
+		patch = append([]patchOperation{{Op: "test", Path: "/metadata/resourceVersion", Value: resourceVersion}}, patch...)
+	}
+	if patchBytes, err = json.Marshal(patch); err != nil {
+		logger.Error("Could not build backfill patch", "error", err)
+		return backfillFailed
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return backfillDeferred
+	}
+	// The window is checked again once the rate limiter let the patch through, since it may have closed while waiting.
+	if !c.window.contains(c.now()) {
+		logger.Debug("Maintenance window closed, deferring backfill")
+		return backfillDeferred
+	}
+	options := metav1.PatchOptions{FieldManager: "toleration-webhook-backfill"}
+	if c.dryRun {
+		options.DryRun = []string{metav1.DryRunAll}
+	}
+	switch kind {
+	case "Deployment":
+		_, err = c.client.AppsV1().Deployments(accessor.GetNamespace()).Patch(ctx, accessor.GetName(), types.JSONPatchType, patchBytes, options)
+	case "DaemonSet":
+		_, err = c.client.AppsV1().DaemonSets(accessor.GetNamespace()).Patch(ctx, accessor.GetName(), types.JSONPatchType, patchBytes, options)
+	default:
+		err = fmt.Errorf("unsupported kind %s", kind)
+	}
+	if err != nil {
+		logger.Warn("Could not backfill toleration", "error", err)
+		return backfillFailed
+	}
+
+	if c.dryRun {
+		logger.Info("Toleration would be backfilled", "toleration", toleration.Key)
+		return backfillDryRun
+	}
+	logger.Info("Toleration backfilled", "toleration", toleration.Key)
+	recordWorkloadTolerationEvent(accessor.GetNamespace(), object, toleration.Key, []corev1.Toleration{toleration})
+	return backfillPatched
+}
+
+// runLeaderElected runs run while holding the lease of the given name and namespace, so that only one replica does so.
+// Leadership is campaigned for again when lost, until ctx is done.
+func runLeaderElected(ctx context.Context, client kubernetes.Interface, namespace, name string, run func(context.Context)) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("could not get leader election identity: %s", err.Error())
+	}
+	config := leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: run,
+			OnStoppedLeading: func() { slog.Info("Stopped leading", "lease", name, "identity", identity) },
+			OnNewLeader:      func(leader string) { slog.Info("New leader elected", "lease", name, "leader", leader) },
+		},
+	}
+	elector, err := leaderelection.NewLeaderElector(config)
+	if err != nil {
+		return fmt.Errorf("could not set up leader election: %s", err.Error())
+	}
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+	return nil
+}
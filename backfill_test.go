@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// TestMaintenanceWindow tests maintenance windows are parsed and contain the expected UTC times, across midnight too.
+func TestMaintenanceWindow(t *testing.T) {
+	testCases := []struct {
+		window        string
+		time          string
+		expected      bool
+		expectedError bool
+	}{
+		{"", "12:00", true, false},
+		{"09:00-17:00", "09:00", true, false},
+		{"09:00-17:00", "16:59", true, false},
+		{"09:00-17:00", "17:00", false, false},
+		{"22:00-06:00", "23:30", true, false},
+		{"22:00-06:00", "05:59", true, false},
+		{"22:00-06:00", "12:00", false, false},
+		{"22:00", "", false, true},
+		{"22:00-25:00", "", false, true},
+		{"06:00-06:00", "", false, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.window+" "+testCase.time, func(t *testing.T) {
+			window, err := parseMaintenanceWindow(testCase.window)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("Expected error %v, got %v", testCase.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			at, err := time.Parse("2006-01-02 15:04", "2024-03-01 "+testCase.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contains := window.contains(at); contains != testCase.expected {
+				t.Errorf("Expected %s to contain %s: %v, got %v", testCase.window, testCase.time, testCase.expected, contains)
+			}
+		})
+	}
+}
+
+// newBackfillClientset returns a fake clientset with compliant and non-compliant workloads in an enabled and a disabled namespace.
+func newBackfillClientset() *fake.Clientset {
+	objectMeta := func(name, namespace string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: namespace, ResourceVersion: "1"}
+	}
+	return fake.NewSimpleClientset(
+		testNamespace("foo", map[string]string{"toleration-webhook": "enabled"}),
+		testNamespace("bar", nil),
+		testDeployment(objectMeta("dep-a", "foo")),
+		testDeployment(objectMeta("dep-b", "foo"), toleration),
+		testDaemonSet(objectMeta("ds-a", "foo")),
+		testDeployment(objectMeta("dep-c", "bar")),
+	)
+}
+
+// newTestBackfillController returns a backfill controller of the enabled namespaces of client without rate limiting in practice.
+func newTestBackfillController(t *testing.T, client *fake.Clientset, dryRun bool, window string) *backfillController {
+	controller, err := newBackfillController(client, serverParameters{
+		namespaceSelector: "toleration-webhook=enabled",
+		backfillDryRun:    dryRun,
+		backfillQPS:       1000,
+		backfillWindow:    window,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return controller
+}
+
+// patchedWorkloads returns the namespace/name of the workloads client received patches for.
+func patchedWorkloads(client *fake.Clientset) []string {
+	var patched []string
+	for _, action := range client.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok {
+			patched = append(patched, patch.GetNamespace()+"/"+patch.GetName())
+		}
+	}
+	return patched
+}
+
+// TestBackfillReconcile tests existing workloads of enabled namespaces missing the toleration are patched once.
+func TestBackfillReconcile(t *testing.T) {
+	useTestMetrics(t)
+	client := newBackfillClientset()
+	controller := newTestBackfillController(t, client, false, "")
+
+	for i := 0; i < 2; i++ {
+		if err := controller.reconcile(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if patched := strings.Join(patchedWorkloads(client), ","); patched != "foo/dep-a,foo/ds-a" {
+		t.Errorf("Expected foo/dep-a and foo/ds-a to be patched once, got %s", patched)
+	}
+
+	deployment, err := client.AppsV1().Deployments("foo").Get(context.Background(), "dep-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tolerations := deployment.Spec.Template.Spec.Tolerations; len(tolerations) != 1 || tolerations[0] != toleration {
+		t.Errorf("Expected the toleration to be backfilled, got %v", tolerations)
+	}
+	if deployment.Annotations["updated_by"] != "tolerationWebhook" {
+		t.Errorf("Expected the webhook annotation, got %v", deployment.Annotations)
+	}
+	untouched, err := client.AppsV1().Deployments("bar").Get(context.Background(), "dep-c", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(untouched.Spec.Template.Spec.Tolerations) != 0 {
+		t.Errorf("Expected workloads of disabled namespaces to be left alone, got %v", untouched.Spec.Template.Spec.Tolerations)
+	}
+
+	for _, kind := range []string{"Deployment", "DaemonSet"} {
+		if count := testutil.ToFloat64(metrics.backfill.WithLabelValues(kind, backfillPatched)); count != 1 {
+			t.Errorf("Expected 1 patched %s, got %v", kind, count)
+		}
+	}
+}
+
+// TestBackfillResults tests dry runs and failed patches are counted without backfilling.
+func TestBackfillResults(t *testing.T) {
+	testCases := []struct {
+		description     string
+		dryRun          bool
+		failPatches     bool
+		expectedResult  string
+		expectedPatches int
+	}{
+		{"dry run", true, false, backfillDryRun, 2},
+		{"patch failed", false, true, backfillFailed, 2},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			useTestMetrics(t)
+			client := newBackfillClientset()
+			if testCase.failPatches {
+				client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "apps", Resource: action.GetResource().Resource}, "", nil)
+				})
+			}
+			// Dry runs are not applied by the API server, the fake clientset stands in for it.
+			if testCase.dryRun {
+				client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, nil
+				})
+			}
+			controller := newTestBackfillController(t, client, testCase.dryRun, "")
+
+			if err := controller.reconcile(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if patches := len(patchedWorkloads(client)); patches != testCase.expectedPatches {
+				t.Errorf("Expected %d patches, got %d", testCase.expectedPatches, patches)
+			}
+			for _, kind := range []string{"Deployment", "DaemonSet"} {
+				if count := testutil.ToFloat64(metrics.backfill.WithLabelValues(kind, testCase.expectedResult)); count != 1 {
+					t.Errorf("Expected 1 %s %s, got %v", testCase.expectedResult, kind, count)
+				}
+			}
+			deployment, err := client.AppsV1().Deployments("foo").Get(context.Background(), "dep-a", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(deployment.Spec.Template.Spec.Tolerations) != 0 {
+				t.Errorf("Expected dep-a to be left alone, got %v", deployment.Spec.Template.Spec.Tolerations)
+			}
+		})
+	}
+}
+
+// advancingLimiter is a rate limiter whose Wait calls wait, standing in for the time a throttled patch waits.
+type advancingLimiter struct {
+	flowcontrol.RateLimiter
+	wait func()
+}
+
+func (l advancingLimiter) Wait(context.Context) error {
+	l.wait()
+	return nil
+}
+
+// TestBackfillWindowClosesWhileWaiting tests patches are deferred when the maintenance window closed while they were rate limited.
+func TestBackfillWindowClosesWhileWaiting(t *testing.T) {
+	useTestMetrics(t)
+	client := newBackfillClientset()
+	controller := newTestBackfillController(t, client, false, "11:00-12:00")
+	now := time.Date(2024, 3, 1, 11, 59, 0, 0, time.UTC)
+	controller.now = func() time.Time { return now }
+	controller.limiter = advancingLimiter{RateLimiter: flowcontrol.NewFakeAlwaysRateLimiter(), wait: func() { now = now.Add(time.Minute) }}
+
+	if err := controller.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if patches := len(patchedWorkloads(client)); patches != 0 {
+		t.Errorf("Expected no patches once the window closed, got %d", patches)
+	}
+	if count := testutil.ToFloat64(metrics.backfill.WithLabelValues("Deployment", backfillDeferred)); count != 1 {
+		t.Errorf("Expected 1 deferred Deployment, got %v", count)
+	}
+}
+
+// TestBackfillWindowClosed tests a pass outside the maintenance window ends at the first deferred patch without rate limiting it.
+func TestBackfillWindowClosed(t *testing.T) {
+	useTestMetrics(t)
+	client := newBackfillClientset()
+	controller := newTestBackfillController(t, client, false, "10:00-11:00")
+	controller.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+	waits := 0
+	controller.limiter = advancingLimiter{RateLimiter: flowcontrol.NewFakeAlwaysRateLimiter(), wait: func() { waits++ }}
+
+	if err := controller.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waits != 0 {
+		t.Errorf("Expected no rate limiter waits outside the window, got %d", waits)
+	}
+	if patches := len(patchedWorkloads(client)); patches != 0 {
+		t.Errorf("Expected no patches outside the window, got %d", patches)
+	}
+	if count := testutil.ToFloat64(metrics.backfill.WithLabelValues("Deployment", backfillDeferred)); count != 1 {
+		t.Errorf("Expected 1 deferred Deployment, got %v", count)
+	}
+	if count := testutil.ToFloat64(metrics.backfill.WithLabelValues("DaemonSet", backfillDeferred)); count != 0 {
+		t.Errorf("Expected the pass to end at the first deferred patch, got %v deferred DaemonSets", count)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	caCertKey         = "ca.crt"
+	caKeyKey          = "ca.key"
+	caValidity        = 10 * 365 * 24 * time.Hour
+	certValidity      = 365 * 24 * time.Hour
+	certRenewBefore   = 30 * 24 * time.Hour
+	certCheckInterval = time.Hour
+)
+
+// serviceDNSNames returns the DNS names the API server may use to reach the webhook service.
+func serviceDNSNames(service, namespace string) []string {
+	return []string{
+		service,
+		service + "." + namespace,
+		service + "." + namespace + ".svc",
+		service + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+// bootstrapSelfSignedCert returns the serving certificate stored in the certificate Secret,
+// issuing a new serving certificate when the Secret is missing, invalid or about to expire.
+// The CA bundle is then injected in the caBundle of the MutatingWebhookConfiguration.
+// Replicas starting together converge on whichever Secret was written first.
+func bootstrapSelfSignedCert(ctx context.Context, client kubernetes.Interface, parameters serverParameters) (*tls.Certificate, error) {
+	dnsNames := serviceDNSNames(parameters.serviceName, parameters.serviceNamespace)
+
+	secret, err := ensureCertSecret(ctx, client, parameters, dnsNames)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("could not load serving certificate from secret %s/%s: %s", secret.Namespace, secret.Name, err.Error())
+	}
+
+	if err := injectCABundle(ctx, client, parameters.webhookConfigName, secret.Data[caCertKey]); err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+// ensureCertSecret returns a certificate Secret that is valid for dnsNames, creating or renewing it when needed.
+func ensureCertSecret(ctx context.Context, client kubernetes.Interface, parameters serverParameters, dnsNames []string) (*corev1.Secret, error) {
+	secrets := client.CoreV1().Secrets(parameters.serviceNamespace)
+
+	secret, err := secrets.Get(ctx, parameters.certSecretName, metav1.GetOptions{})
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not get secret %s/%s: %s", parameters.serviceNamespace, parameters.certSecretName, err.Error())
+	}
+	if exists && certSecretValid(secret, dnsNames, time.Now()) {
+		slog.Debug("Using existing self-signed certificate", "secret", parameters.certSecretName, "namespace", parameters.serviceNamespace)
+		return secret, nil
+	}
+
+	var previous map[string][]byte
+	if exists {
+		previous = secret.Data
+	}
+	data, err := renewSelfSignedCert(previous, dnsNames, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      parameters.certSecretName,
+				Namespace: parameters.serviceNamespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "toleration-webhook"},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}
+		created, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// Another replica created the Secret first, use its certificate.
+			return secrets.Get(ctx, parameters.certSecretName, metav1.GetOptions{})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not create secret %s/%s: %s", parameters.serviceNamespace, parameters.certSecretName, err.Error())
+		}
+		slog.Info("Generated self-signed certificate", "secret", parameters.certSecretName, "namespace", parameters.serviceNamespace)
+		return created, nil
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data = data
+	updated, err := secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		// Another replica renewed the Secret first, use its certificate.
+		return secrets.Get(ctx, parameters.certSecretName, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not update secret %s/%s: %s", parameters.serviceNamespace, parameters.certSecretName, err.Error())
+	}
+	slog.Info("Renewed self-signed certificate", "secret", parameters.certSecretName, "namespace", parameters.serviceNamespace)
+	return updated, nil
+}
+
+// certSecretValid checks the Secret holds a serving certificate signed by its CA,
+// valid for every DNS name and not due for renewal.
+func certSecretValid(secret *corev1.Secret, dnsNames []string, now time.Time) bool {
+	if _, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+		return false
+	}
+
+	certBlock, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if certBlock == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil || now.Add(certRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(secret.Data[caCertKey]) {
+		return false
+	}
+	for _, dnsName := range dnsNames {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: dnsName, Roots: roots, CurrentTime: now}); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// renewSelfSignedCert issues a serving certificate for dnsNames signed by the CA of the previous Secret data,
+// returned as the data of a kubernetes.io/tls Secret. The CA is kept so that replicas still serving the previous
+// certificate keep verifying against the caBundle. A new CA is generated when there is none or it would expire
+// before the new serving certificate; the previous CAs stay in the bundle until they expire.
+func renewSelfSignedCert(previous map[string][]byte, dnsNames []string, now time.Time) (map[string][]byte, error) {
+	bundle := parseCertificates(previous[caCertKey])
+	caCert, caKey := parseCA(previous)
+	if caCert == nil || caCert.NotAfter.Before(now.Add(certValidity)) {
+		var err error
+		if caCert, caKey, err = generateCA(now); err != nil {
+			return nil, err
+		}
+		bundle = append([]*x509.Certificate{caCert}, bundle...)
+	}
+	var caBundle []byte
+	for _, cert := range bundle {
+		if cert.NotAfter.After(now) {
+			caBundle = append(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+	}
+	caKeyDER, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal CA key: %s", err.Error())
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate serving key: %s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[len(dnsNames)-2]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not create serving certificate: %s", err.Error())
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal serving key: %s", err.Error())
+	}
+
+	return map[string][]byte{
+		caCertKey:               caBundle,
+		caKeyKey:                pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDER}),
+		corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// generateCA generates a self-signed CA valid for caValidity.
+func generateCA(now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not generate CA key: %s", err.Error())
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: "toleration-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create CA certificate: %s", err.Error())
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse CA certificate: %s", err.Error())
+	}
+	return caCert, caKey, nil
+}
+
+// parseCA returns the current CA of the Secret data, the first certificate of its bundle, with its key.
+// Nil is returned when either is missing or they do not match.
+func parseCA(data map[string][]byte) (*x509.Certificate, *ecdsa.PrivateKey) {
+	certs := parseCertificates(data[caCertKey])
+	keyBlock, _ := pem.Decode(data[caKeyKey])
+	if len(certs) == 0 || keyBlock == nil {
+		return nil, nil
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil || !key.PublicKey.Equal(certs[0].PublicKey) {
+		return nil, nil
+	}
+	return certs[0], key
+}
+
+// parseCertificates returns the certificates of a PEM bundle, skipping blocks that do not parse.
+func parseCertificates(bundle []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return certs
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+// certReloader serves the self-signed certificate and renews it before it expires,
+// picking up certificates renewed by other replicas too.
+type certReloader struct {
+	client     kubernetes.Interface
+	parameters serverParameters
+	cert       atomic.Pointer[tls.Certificate]
+}
+
+// newCertReloader returns a certReloader serving the bootstrapped self-signed certificate.
+func newCertReloader(ctx context.Context, client kubernetes.Interface, parameters serverParameters) (*certReloader, error) {
+	r := &certReloader{client: client, parameters: parameters}
+	if err := r.reload(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload bootstraps the self-signed certificate again and serves it from now on.
+func (r *certReloader) reload(ctx context.Context) error {
+	cert, err := bootstrapSelfSignedCert(ctx, r.client, r.parameters)
+	if err != nil {
+		return err
+	}
+	r.cert.Store(cert)
+	return nil
+}
+
+// run reloads the certificate every interval until ctx is done.
+func (r *certReloader) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.reload(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("Could not renew self-signed certificate", "error", err)
+			}
+		}
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// current returns the certificate being served.
+func (r *certReloader) current() (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// newSerialNumber returns a random 128-bit certificate serial number.
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+// injectCABundle sets caBundle on every webhook of the MutatingWebhookConfiguration.
+func injectCABundle(ctx context.Context, client kubernetes.Interface, webhookConfigName string, caBundle []byte) error {
+	configurations := client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+
+	changed := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configuration, err := configurations.Get(ctx, webhookConfigName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		changed = false
+		for i := range configuration.Webhooks {
+			if !bytes.Equal(configuration.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				configuration.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		_, err = configurations.Update(ctx, configuration, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not inject caBundle in MutatingWebhookConfiguration %s: %s", webhookConfigName, err.Error())
+	}
+
+	if changed {
+		slog.Info("Injected caBundle in MutatingWebhookConfiguration", "name", webhookConfigName)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestBootstrapSelfSignedCert tests the certificate Secret is created, reused and its CA injected in the webhook configuration.
+func TestBootstrapSelfSignedCert(t *testing.T) {
+	parameters := serverParameters{
+		serviceName:       "toleration-webhook",
+		serviceNamespace:  "toleration-webhook",
+		certSecretName:    "toleration-webhook-self-signed",
+		webhookConfigName: "toleration-webhook",
+	}
+	client := fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "toleration-webhook"},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{Name: "toleration-webhook.toleration-webhook.svc.cluster.local"},
+		},
+	})
+	ctx := context.Background()
+
+	cert, err := bootstrapSelfSignedCert(ctx, client, parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := client.CoreV1().Secrets("toleration-webhook").Get(ctx, "toleration-webhook-self-signed", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected certificate Secret to be created: %s", err.Error())
+	}
+	if secret.Type != corev1.SecretTypeTLS {
+		t.Errorf("Expected Secret type %s, got %s", corev1.SecretTypeTLS, secret.Type)
+	}
+	if !certSecretValid(secret, serviceDNSNames("toleration-webhook", "toleration-webhook"), time.Now()) {
+		t.Error("Expected generated certificate to be valid for the service DNS names")
+	}
+
+	configuration, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "toleration-webhook", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(configuration.Webhooks[0].ClientConfig.CABundle, secret.Data[caCertKey]) {
+		t.Error("Expected caBundle to be injected in the MutatingWebhookConfiguration")
+	}
+
+	// A second replica reuses the stored certificate instead of generating a new one.
+	reused, err := bootstrapSelfSignedCert(ctx, client, parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reused.Certificate[0], cert.Certificate[0]) {
+		t.Error("Expected the existing certificate to be reused")
+	}
+}
+
+// TestBootstrapSelfSignedCertRenewal tests that certificates close to expiry are renewed by the same CA.
+func TestBootstrapSelfSignedCertRenewal(t *testing.T) {
+	dnsNames := serviceDNSNames("toleration-webhook", "toleration-webhook")
+	data, err := renewSelfSignedCert(nil, dnsNames, time.Now().Add(-certValidity+certRenewBefore/2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "toleration-webhook-self-signed", Namespace: "toleration-webhook"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       data,
+	}
+	if certSecretValid(expiring, dnsNames, time.Now()) {
+		t.Fatal("Expected certificate due for renewal to be invalid")
+	}
+
+	client := fake.NewSimpleClientset(expiring, &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "toleration-webhook"},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "toleration-webhook.toleration-webhook.svc.cluster.local"}},
+	})
+	parameters := serverParameters{
+		serviceName:       "toleration-webhook",
+		serviceNamespace:  "toleration-webhook",
+		certSecretName:    "toleration-webhook-self-signed",
+		webhookConfigName: "toleration-webhook",
+	}
+	if _, err := bootstrapSelfSignedCert(context.Background(), client, parameters); err != nil {
+		t.Fatal(err)
+	}
+
+	renewed, err := client.CoreV1().Secrets("toleration-webhook").Get(context.Background(), "toleration-webhook-self-signed", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certSecretValid(renewed, dnsNames, time.Now()) {
+		t.Error("Expected the certificate to be renewed")
+	}
+	if !bytes.Equal(renewed.Data[caCertKey], data[caCertKey]) {
+		t.Error("Expected the CA to be kept")
+	}
+}
+
+// TestRenewSelfSignedCertCAExpiring tests that a CA expiring before the new serving certificate is rotated,
+// the previous CA staying in the bundle so that certificates it signed keep verifying.
+func TestRenewSelfSignedCertCAExpiring(t *testing.T) {
+	dnsNames := serviceDNSNames("toleration-webhook", "toleration-webhook")
+	now := time.Now()
+	previous, err := renewSelfSignedCert(nil, dnsNames, now.Add(-caValidity+certRenewBefore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous[corev1.TLSCertKey], previous[corev1.TLSPrivateKeyKey] = nil, nil
+	previousCA := parseCertificates(previous[caCertKey])[0]
+
+	data, err := renewSelfSignedCert(previous, dnsNames, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := parseCertificates(data[caCertKey])
+	if len(bundle) != 2 {
+		t.Fatalf("Expected the new and previous CA in the bundle, got %d certificates", len(bundle))
+	}
+	if !bundle[1].Equal(previousCA) {
+		t.Error("Expected the previous CA to stay in the bundle")
+	}
+	if caCert, _ := parseCA(data); caCert == nil || caCert.Equal(previousCA) || caCert.NotAfter.Before(now.Add(certValidity)) {
+		t.Error("Expected a new CA outliving the serving certificate")
+	}
+	if !certSecretValid(&corev1.Secret{Data: data}, dnsNames, now) {
+		t.Error("Expected the serving certificate to be valid")
+	}
+
+	// Once expired, the previous CA is dropped from the bundle on the next renewal.
+	data, err = renewSelfSignedCert(data, dnsNames, now.Add(certValidity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle := parseCertificates(data[caCertKey]); len(bundle) != 1 || bundle[0].Equal(previousCA) {
+		t.Error("Expected the expired CA to be dropped from the bundle")
+	}
+}
+
+// TestCertReloader tests that the served certificate is swapped when the certificate Secret is renewed.
+func TestCertReloader(t *testing.T) {
+	parameters := serverParameters{
+		serviceName:       "toleration-webhook",
+		serviceNamespace:  "toleration-webhook",
+		certSecretName:    "toleration-webhook-self-signed",
+		webhookConfigName: "toleration-webhook",
+	}
+	client := fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "toleration-webhook"},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "toleration-webhook.toleration-webhook.svc.cluster.local"}},
+	})
+	ctx := context.Background()
+
+	reloader, err := newCertReloader(ctx, client, parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another replica renewed the certificate.
+	secret, err := client.CoreV1().Secrets("toleration-webhook").Get(ctx, "toleration-webhook-self-signed", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Data, err = renewSelfSignedCert(secret.Data, serviceDNSNames("toleration-webhook", "toleration-webhook"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoreV1().Secrets("toleration-webhook").Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reloader.reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(reloaded.Certificate[0], served.Certificate[0]) {
+		t.Error("Expected the renewed certificate to be served")
+	}
+}
+
+// TestBootstrapSelfSignedCertMissingWebhookConfig tests that a missing MutatingWebhookConfiguration is reported.
+func TestBootstrapSelfSignedCertMissingWebhookConfig(t *testing.T) {
+	parameters := serverParameters{
+		serviceName:       "toleration-webhook",
+		serviceNamespace:  "toleration-webhook",
+		certSecretName:    "toleration-webhook-self-signed",
+		webhookConfigName: "toleration-webhook",
+	}
+	if _, err := bootstrapSelfSignedCert(context.Background(), fake.NewSimpleClientset(), parameters); err == nil {
+		t.Error("Expected an error when the MutatingWebhookConfiguration does not exist")
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"io"
+)
+
+// subcommand runs a CLI mode of the webhook with its arguments and returns the process exit code.
+type subcommand func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// subcommands are the CLI modes selected by the first argument, running the webhook logic offline.
+var subcommands = map[string]subcommand{
+	"mutate":   runMutate,
+	"krm":      runKRM,
+	"simulate": runSimulate,
+	"audit":    runAudit,
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+const (
+	cloudEventsSinkName        = "cloudevents"
+	cloudEventsContentType     = "application/cloudevents+json"
+	cloudEventsTypePrefix      = "io.github.andreistefanciprian.toleration-webhook.decision."
+	cloudEventsSignatureHeader = "X-Toleration-Webhook-Signature"
+	cloudEventsMaxBackoff      = 30 * time.Second
+)
+
+// cloudEvent is a CloudEvents 1.0 event in structured JSON mode, see https://github.com/cloudevents/spec
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            decision  `json:"data"`
+}
+
+// cloudEventsSink POSTs admission decisions with the configured actions to url as CloudEvents.
+// Decisions are queued and sent by a background goroutine, retrying failed deliveries with exponential backoff;
+// decisions arriving while the queue is full are dropped and counted.
+// With a signing key, the HMAC-SHA256 of each body is sent hex encoded in the X-Toleration-Webhook-Signature header.
+type cloudEventsSink struct {
+	url         string
+	source      string
+	actions     map[string]bool
+	signingKey  []byte
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+
+	ctx    context.Context // canceled by Close to abort the delivery in flight
+	cancel context.CancelFunc
+	mu     sync.RWMutex // guards closed against Record sending on the closed queue
+	closed bool
+	queue  chan decision
+	done   chan struct{}
+}
+
+// newCloudEventsSink returns a CloudEvents sink sending decisions with the comma-separated actions to url.
+func newCloudEventsSink(url, source, actions, signingKey string, queueSize, maxAttempts int, backoff time.Duration) *cloudEventsSink {
+	s := &cloudEventsSink{
+		url:         url,
+		source:      source,
+		actions:     map[string]bool{},
+		signingKey:  []byte(signingKey),
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan decision, queueSize),
+		done:        make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, action := range strings.Split(actions, ",") {
+		s.actions[strings.TrimSpace(action)] = true
+	}
+	go s.run()
+	return s
+}
+
+// Record queues d to be sent when its action is one of the sink's, dropping it when the queue is full or the sink is closed.
+func (s *cloudEventsSink) Record(d decision) {
+	if !s.actions[d.Action] {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		RecordDroppedDecision(cloudEventsSinkName)
+		return
+	}
+	select {
+	case s.queue <- d:
+	default:
+		RecordDroppedDecision(cloudEventsSinkName)
+	}
+}
+
+// Close sends the queued decisions, giving up when ctx is done: the delivery in flight is then aborted
+// and the decisions still queued are dropped. Decisions recorded afterwards are dropped.
+func (s *cloudEventsSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		return fmt.Errorf("could not send queued CloudEvents: %s", ctx.Err().Error())
+	}
+}
+
+// run sends queued decisions until the queue is closed, dropping them once the sink is canceled.
+// The delivery aborted by the cancellation counts as dropped too.
+func (s *cloudEventsSink) run() {
+	defer close(s.done)
+	for d := range s.queue {
+		if s.ctx.Err() != nil {
+			RecordDroppedDecision(cloudEventsSinkName)
+			continue
+		}
+		if err := s.send(s.ctx, d); err != nil {
+			slog.Error("Could not send CloudEvent", "uid", d.UID, "url", s.url, "error", err)
+			if s.ctx.Err() != nil {
+				RecordDroppedDecision(cloudEventsSinkName)
+			}
+		}
+	}
+}
+
+// send POSTs d as a CloudEvent, retrying network errors, 429 and 5xx responses up to maxAttempts times
+// until ctx is done. Decisions without a UID, such as requests that could not be parsed, get a random event ID.
+func (s *cloudEventsSink) send(ctx context.Context, d decision) error {
+	id := string(d.UID) + "/" + d.Action
+	if d.UID == "" {
+		id = string(uuid.NewUUID())
+	}
+	body, err := json.Marshal(cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              id,
+		Source:          s.source,
+		Type:            cloudEventsTypePrefix + d.Action,
+		Subject:         strings.Trim(d.Namespace+"/"+d.Name, "/"),
+		Time:            d.Time,
+		DataContentType: jsonContentType,
+		Data:            d,
+	})
+	if err != nil {
+		return err
+	}
+
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.maxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %s", attempt, err.Error())
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("giving up after %d attempts: %s", attempt, ctx.Err().Error())
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, cloudEventsMaxBackoff)
+	}
+}
+
+// post sends a single delivery of body, reporting whether a failure is worth retrying.
+func (s *cloudEventsSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", cloudEventsContentType)
+	if len(s.signingKey) > 0 {
+		req.Header.Set(cloudEventsSignatureHeader, "sha256="+signBody(s.signingKey, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected response status %s", resp.Status)
+}
+
+// signBody returns the hex encoded HMAC-SHA256 of body with key.
+func signBody(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
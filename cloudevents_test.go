@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// cloudEventsReceiver is an httptest server recording the CloudEvents it receives,
+// failing the first failures deliveries with 503.
+type cloudEventsReceiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	failures   int
+	attempts   int
+	events     []cloudEvent
+	signatures []string
+}
+
+func newCloudEventsReceiver(t *testing.T, failures int) *cloudEventsReceiver {
+	receiver := &cloudEventsReceiver{failures: failures}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.attempts++
+		if receiver.attempts <= receiver.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Type") != cloudEventsContentType {
+			t.Errorf("Expected Content-Type %s, got %s", cloudEventsContentType, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		var event cloudEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Invalid CloudEvent %s: %s", body, err.Error())
+		}
+		receiver.events = append(receiver.events, event)
+		receiver.signatures = append(receiver.signatures, r.Header.Get(cloudEventsSignatureHeader))
+		if signature := r.Header.Get(cloudEventsSignatureHeader); signature != "" && signature != "sha256="+signBody([]byte("secret"), body) {
+			t.Errorf("Invalid signature %s", signature)
+		}
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+// TestCloudEventsSink tests that decisions with the configured actions are sent as signed CloudEvents, retrying failures.
+func TestCloudEventsSink(t *testing.T) {
+	receiver := newCloudEventsReceiver(t, 2)
+	sink := newCloudEventsSink(receiver.URL, "test", "mutated,denied", "secret", 10, 3, time.Millisecond)
+
+	sink.Record(decision{UID: "1", Action: decisionMutated, Namespace: "foo", Name: "test-ds", Kind: "DaemonSet"})
+	sink.Record(decision{UID: "2", Action: decisionUnchanged})
+	sink.Record(decision{UID: "3", Action: decisionDenied})
+	if err := sink.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if receiver.attempts != 4 || len(receiver.events) != 2 {
+		t.Fatalf("Expected 2 events delivered in 4 attempts, got %d events in %d attempts", len(receiver.events), receiver.attempts)
+	}
+	event := receiver.events[0]
+	if event.SpecVersion != "1.0" || event.Source != "test" || event.Type != cloudEventsTypePrefix+decisionMutated ||
+		event.ID != "1/mutated" || event.Subject != "foo/test-ds" || event.Data.Kind != "DaemonSet" {
+		t.Errorf("Unexpected CloudEvent %+v", event)
+	}
+	if receiver.events[1].Type != cloudEventsTypePrefix+decisionDenied {
+		t.Errorf("Expected a denied CloudEvent, got %s", receiver.events[1].Type)
+	}
+	for _, signature := range receiver.signatures {
+		if signature == "" {
+			t.Error("Expected signed CloudEvents")
+		}
+	}
+}
+
+// TestCloudEventsSinkGivesUp tests that deliveries stop after maxAttempts and client errors are not retried.
+func TestCloudEventsSinkGivesUp(t *testing.T) {
+	receiver := newCloudEventsReceiver(t, 10)
+	sink := &cloudEventsSink{url: receiver.URL, maxAttempts: 3, backoff: time.Millisecond, client: receiver.Client()}
+	if err := sink.send(context.Background(), decision{UID: "1", Action: decisionMutated}); err == nil || receiver.attempts != 3 {
+		t.Errorf("Expected an error after 3 attempts, got %v after %d attempts", err, receiver.attempts)
+	}
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	sink.url = notFound.URL
+	if retry, err := sink.post(context.Background(), []byte("{}")); err == nil || retry {
+		t.Errorf("Expected a non retryable error, got %v", err)
+	}
+}
+
+// TestCloudEventsSinkDrops tests that decisions are dropped and counted instead of blocking when the queue is full.
+func TestCloudEventsSinkDrops(t *testing.T) {
+	useTestMetrics(t)
+	sink := &cloudEventsSink{actions: map[string]bool{decisionMutated: true}, queue: make(chan decision, 1)}
+
+	sink.Record(decision{UID: "1", Action: decisionMutated})
+	sink.Record(decision{UID: "2", Action: decisionMutated})
+
+	if dropped := testutil.ToFloat64(metrics.droppedDecisions.WithLabelValues(cloudEventsSinkName)); dropped != 1 {
+		t.Errorf("Expected 1 dropped decision, got %v", dropped)
+	}
+}
+
+// TestCloudEventsSinkClose tests that Close aborts the delivery in flight when its context is done,
+// and that decisions recorded after Close are dropped instead of panicking.
+func TestCloudEventsSinkClose(t *testing.T) {
+	useTestMetrics(t)
+	receiver := newCloudEventsReceiver(t, 100)
+	sink := newCloudEventsSink(receiver.URL, "test", "mutated", "", 10, 100, time.Hour)
+
+	sink.Record(decision{UID: "1", Action: decisionMutated})
+	sink.Record(decision{UID: "2", Action: decisionMutated})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sink.Close(ctx); err == nil {
+		t.Error("Expected an error when the queued CloudEvents could not be sent")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Close to abort the retry backoff, took %s", elapsed)
+	}
+
+	sink.Record(decision{UID: "3", Action: decisionMutated})
+	if err := sink.Close(context.Background()); err != nil {
+		t.Errorf("Expected closing twice to succeed, got %s", err.Error())
+	}
+	if dropped := testutil.ToFloat64(metrics.droppedDecisions.WithLabelValues(cloudEventsSinkName)); dropped != 3 {
+		t.Errorf("Expected the aborted, queued and late decisions to be dropped, got %v", dropped)
+	}
+}
+
+// TestCloudEventsSinkRandomID tests that decisions without a UID get distinct event IDs.
+func TestCloudEventsSinkRandomID(t *testing.T) {
+	receiver := newCloudEventsReceiver(t, 0)
+	sink := &cloudEventsSink{url: receiver.URL, maxAttempts: 1, client: receiver.Client()}
+	for i := 0; i < 2; i++ {
+		if err := sink.send(context.Background(), decision{Action: decisionDenied}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(receiver.events) != 2 || receiver.events[0].ID == "" || receiver.events[0].ID == receiver.events[1].ID {
+		t.Errorf("Expected distinct event IDs, got %+v", receiver.events)
+	}
+}
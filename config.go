@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// cliOnlyFlags are the flags that are only read from the command line.
+var cliOnlyFlags = map[string]bool{"config": true, "print-config": true, "version": true}
+
+// secretFlags are the flags whose values are redacted by --print-config.
+var secretFlags = map[string]bool{"cloudEventsSigningKey": true}
+
+// envPrefix prefixes the environment variables overriding config file values, e.g. TOLERATION_WEBHOOK_HTTPS_PORT.
+const envPrefix = "TOLERATION_WEBHOOK_"
+
+// parseFlags parses the CLI params, environment variables and config file and returns a serverParameters struct.
+// The toleration of --policyFile replaces the built-in one. With --print-config the effective configuration,
+// or with --version the build details, is written to stdout and the process exits.
+func parseFlags() serverParameters {
+	parameters, err := loadConfig(flag.CommandLine, os.Args[1:], os.LookupEnv)
+	if err == nil && parameters.policyFile != "" {
+		toleration = parameters.policy
+	}
+	if parameters.printVersion {
+		json.NewEncoder(os.Stdout).Encode(currentVersionInfo())
+		os.Exit(0)
+	}
+	if parameters.printConfig {
+		if printErr := printConfig(os.Stdout, flag.CommandLine); printErr != nil {
+			err = errors.Join(err, printErr)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err.Error())
+		os.Exit(2)
+	}
+	if parameters.printConfig {
+		os.Exit(0)
+	}
+	return parameters
+}
+
+// defineFlags defines the webhook CLI params on fs, storing their values in parameters.
+func defineFlags(fs *flag.FlagSet, parameters *serverParameters) {
+	fs.IntVar(&parameters.httpsPort, "httpsPort", 443, " Https server port (webhook endpoint).")
+	fs.StringVar(&parameters.certFile, "tlsCertFile", "/etc/webhook/certs/tls.crt", "File containing the x509 Certificate for HTTPS.")
+	fs.StringVar(&parameters.keyFile, "tlsKeyFile", "/etc/webhook/certs/tls.key", "File containing the x509 private key to --tlsCertFile.")
+	fs.IntVar(&parameters.httpPort, "httpPort", 9090, " Http server port (monitoring endpoint).")
+	fs.Int64Var(&parameters.maxRequestBytes, "maxRequestBytes", defaultMaxRequestBytes, "Maximum size in bytes of an AdmissionReview request body.")
+	fs.IntVar(&parameters.maxInFlight, "maxInFlight", 64, "Maximum number of concurrent webhook requests, 0 disables the limit.")
+	fs.IntVar(&parameters.webhookTimeoutSeconds, "webhookTimeoutSeconds", 30, "timeoutSeconds of the MutatingWebhookConfiguration, used to derive the https server timeouts.")
+	fs.DurationVar(&parameters.readTimeout, "readTimeout", 0, "Https server read timeout (defaults to webhookTimeoutSeconds).")
+	fs.DurationVar(&parameters.writeTimeout, "writeTimeout", 0, "Https server write timeout (defaults to webhookTimeoutSeconds).")
+	fs.DurationVar(&parameters.idleTimeout, "idleTimeout", 0, "Https server keep-alive idle timeout (defaults to 3x webhookTimeoutSeconds).")
+	fs.BoolVar(&parameters.denyOnPanic, "denyOnPanic", false, "Deny admission requests whose handling panicked (fail closed) instead of allowing them without a patch.")
+	fs.StringVar(&parameters.policyFile, "policyFile", "", "TolerationPolicy YAML file with the toleration added to supported workloads, empty keeps the built-in "+toleration.Key+" toleration.")
+	fs.StringVar(&parameters.logFormat, "logFormat", "json", "Log output format: json or text.")
+	fs.StringVar(&parameters.logLevel, "logLevel", "info", "Minimum log level: debug, info, warn or error.")
+	fs.BoolVar(&parameters.debugBodies, "debugBodies", false, "Log redacted AdmissionReview requests, responses and decoded patches at debug level.")
+	fs.StringVar(&parameters.debugRedactPaths, "debugRedactPaths", "", "Comma-separated dotted JSON paths to redact from logged bodies, e.g. request.object.spec.template.spec.containers.*.args.")
+	fs.IntVar(&parameters.debugMaxBodyBytes, "debugMaxBodyBytes", 16<<10, "Maximum size in bytes of each logged body, larger bodies are truncated.")
+	fs.Float64Var(&parameters.debugSampleRate, "debugSampleRate", 1, "Fraction of requests whose bodies are logged when --debugBodies is set, between 0 and 1.")
+	fs.StringVar(&parameters.certMode, "certMode", certModeFile, "Serving certificate source: file (--tlsCertFile/--tlsKeyFile) or self-signed (generated and stored in --certSecretName).")
+	fs.StringVar(&parameters.kubeconfig, "kubeconfig", "", "Kubeconfig file, the in-cluster config is used when empty.")
+	fs.StringVar(&parameters.serviceName, "serviceName", "toleration-webhook", "Name of the Service in front of the webhook.")
+	fs.StringVar(&parameters.serviceNamespace, "serviceNamespace", podNamespace(), "Namespace of the webhook Service and certificate Secret.")
+	fs.StringVar(&parameters.certSecretName, "certSecretName", "toleration-webhook-self-signed", "Secret holding the self-signed CA and serving certificate.")
+	fs.StringVar(&parameters.webhookConfigName, "webhookConfigName", "toleration-webhook", "Name of the MutatingWebhookConfiguration pointing at this webhook.")
+	fs.BoolVar(&parameters.registerWebhook, "registerWebhook", false, "Create or update the MutatingWebhookConfiguration at startup from the supported kinds and selectors.")
+	fs.BoolVar(&parameters.unregisterOnShutdown, "unregisterOnShutdown", false, "Delete the MutatingWebhookConfiguration on shutdown (single replica setups only).")
+	fs.StringVar(&parameters.caFile, "caFile", "", "PEM encoded CA written to the registered caBundle in file certificate mode, empty keeps the existing caBundle.")
+	fs.StringVar(&parameters.namespaceSelector, "namespaceSelector", "toleration-webhook=enabled", "Label selector of the namespaces the registered webhook applies to.")
+	fs.StringVar(&parameters.objectSelector, "objectSelector", "", "Label selector of the objects the registered webhook applies to.")
+	fs.StringVar(&parameters.failurePolicy, "failurePolicy", "Ignore", "failurePolicy of the registered webhook: Ignore or Fail.")
+	fs.BoolVar(&parameters.metricsNamespaceLabel, "metricsNamespaceLabel", true, "Label toleration_webhook_total with the object namespace.")
+	fs.IntVar(&parameters.metricsObjectLimit, "metricsObjectLimit", 0, "Track toleration_webhook_object_total per object for up to this many recently admitted objects, 0 disables it.")
+	fs.BoolVar(&parameters.enablePprof, "enablePprof", false, "Serve net/http/pprof endpoints under /debug/pprof/ on the monitoring port.")
+	fs.BoolVar(&parameters.enableExpvar, "enableExpvar", false, "Serve expvar endpoint /debug/vars on the monitoring port.")
+	fs.StringVar(&parameters.otlpEndpoint, "otlpEndpoint", "", "OTLP/HTTP endpoint URL admission spans are exported to, e.g. http://otel-collector:4318. Empty disables tracing.")
+	fs.Float64Var(&parameters.traceSampleRatio, "traceSampleRatio", 1, "Ratio of traces to sample when the caller did not send a sampling decision, between 0 and 1.")
+	fs.BoolVar(&parameters.recordEvents, "recordEvents", false, "Record a Normal Event on every workload the webhook adds tolerations to.")
+	fs.Float64Var(&parameters.eventQPS, "eventQPS", 1.0/300, "Sustained rate of Events recorded per workload once --eventBurst is used up.")
+	fs.IntVar(&parameters.eventBurst, "eventBurst", 25, "Number of Events recorded per workload before --eventQPS applies.")
+	fs.StringVar(&parameters.decisionLogFile, "decisionLogFile", "", "File every admission decision is appended to as a JSON line, empty disables the decision log.")
+	fs.Int64Var(&parameters.decisionLogMaxBytes, "decisionLogMaxBytes", 100<<20, "Size in bytes at which the decision log is rotated.")
+	fs.DurationVar(&parameters.decisionLogMaxAge, "decisionLogMaxAge", 24*time.Hour, "Age at which the decision log is rotated.")
+	fs.IntVar(&parameters.decisionLogMaxBackups, "decisionLogMaxBackups", 5, "Number of rotated decision logs kept.")
+	fs.IntVar(&parameters.decisionLogQueue, "decisionLogQueue", 1024, "Number of decisions queued for writing, further decisions are dropped until the queue drains.")
+	fs.IntVar(&parameters.recentDecisions, "recentDecisions", 0, "Number of recent admission decisions served at /debug/decisions on the monitoring port, 0 disables it.")
+	fs.BoolVar(&parameters.coverageMetrics, "coverageMetrics", false, "Report compliant and non-compliant workloads in the namespaces matching --namespaceSelector from cluster-wide informers.")
+	fs.DurationVar(&parameters.driftCheckInterval, "driftCheckInterval", 0, "Interval of the checks that the MutatingWebhookConfiguration still points at this webhook, 0 disables them.")
+	fs.StringVar(&parameters.cloudEventsURL, "cloudEventsURL", "", "URL admission decisions are POSTed to as CloudEvents, empty disables CloudEvents.")
+	fs.StringVar(&parameters.cloudEventsSource, "cloudEventsSource", "toleration-webhook", "Source attribute of the CloudEvents sent.")
+	fs.StringVar(&parameters.cloudEventsActions, "cloudEventsActions", decisionMutated+","+decisionDenied, "Comma-separated decision actions sent as CloudEvents: mutated, unchanged, ignored or denied.")
+	fs.StringVar(&parameters.cloudEventsSigningKey, "cloudEventsSigningKey", "", "Key signing CloudEvents bodies with HMAC-SHA256 in the X-Toleration-Webhook-Signature header, empty disables signing.")
+	fs.IntVar(&parameters.cloudEventsQueue, "cloudEventsQueue", 1024, "Number of CloudEvents queued for sending, further decisions are dropped until the queue drains.")
+	fs.IntVar(&parameters.cloudEventsAttempts, "cloudEventsAttempts", 5, "Maximum number of delivery attempts per CloudEvent.")
+	fs.DurationVar(&parameters.cloudEventsBackoff, "cloudEventsBackoff", 500*time.Millisecond, "Delay before retrying a failed CloudEvent delivery, doubled on each retry up to 30s.")
+	fs.DurationVar(&parameters.backfillInterval, "backfillInterval", 0, "Interval at which existing workloads in the namespaces matching --namespaceSelector are patched with the toleration, 0 disables the backfill.")
+	fs.BoolVar(&parameters.backfillDryRun, "backfillDryRun", false, "Send backfill patches as server-side dry runs, logging and counting the workloads that would be patched.")
+	fs.Float64Var(&parameters.backfillQPS, "backfillQPS", 0.1, "Maximum number of backfill patches per second, each patch rolls out the workload.")
+	fs.StringVar(&parameters.backfillWindow, "backfillWindow", "", "Daily HH:MM-HH:MM UTC maintenance window backfill patches are sent in, e.g. 22:00-06:00, empty allows any time.")
+	fs.StringVar(&parameters.backfillLeaseName, "backfillLeaseName", "toleration-webhook-backfill", "Lease in the webhook namespace the replicas elect the backfill leader with, empty disables leader election.")
+}
+
+// loadConfig layers the webhook configuration: flag defaults, overridden by the YAML config file,
+// overridden by TOLERATION_WEBHOOK_* environment variables, overridden by the CLI params in args.
+// Config file keys are flag names. A set but empty environment variable clears the config file value.
+// Every invalid setting is reported in the returned error.
+func loadConfig(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (serverParameters, error) {
+	var parameters serverParameters
+	defineFlags(fs, &parameters)
+	fs.StringVar(&parameters.configFile, "config", "", "YAML config file keyed by flag name, overridden by "+envPrefix+"* environment variables and CLI params.")
+	fs.BoolVar(&parameters.printConfig, "print-config", false, "Print the effective configuration as YAML and exit.")
+	fs.BoolVar(&parameters.printVersion, "version", false, "Print the build and policy details as JSON and exit.")
+	if err := fs.Parse(args); err != nil {
+		return parameters, err
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if value, ok := lookupEnv(envName("config")); ok && !explicit["config"] {
+		parameters.configFile = value
+	}
+	fileValues, err := readConfigFile(parameters.configFile)
+	if err != nil {
+		return parameters, err
+	}
+
+	var errs []error
+	for name := range fileValues {
+		if fs.Lookup(name) == nil || cliOnlyFlags[name] {
+			errs = append(errs, fmt.Errorf("config file %s: unknown setting %q", parameters.configFile, name))
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || cliOnlyFlags[f.Name] {
+			return
+		}
+		if value, ok := lookupEnv(envName(f.Name)); ok {
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("environment variable %s: invalid value %q: %s", envName(f.Name), value, err.Error()))
+			}
+			return
+		}
+		if value, ok := fileValues[f.Name]; ok {
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("config file %s: %s: invalid value %q: %s", parameters.configFile, f.Name, value, err.Error()))
+			}
+		}
+	})
+
+	if parameters.policyFile != "" {
+		if parameters.policy, err = readTolerationPolicy(parameters.policyFile); err != nil {
+			errs = append(errs, fmt.Errorf("policyFile: %s", err.Error()))
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	errs = append(errs, parameters.validate())
+	return parameters, errors.Join(errs...)
+}
+
+// envName returns the environment variable overriding a flag, e.g. TOLERATION_WEBHOOK_HTTPS_PORT for httpsPort.
+func envName(flagName string) string {
+	var name strings.Builder
+	name.WriteString(envPrefix)
+	runes := []rune(flagName)
+	for i, r := range runes {
+		if r == '-' {
+			name.WriteRune('_')
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+			name.WriteRune('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
+
+// readConfigFile reads a YAML config file into flag values keyed by flag name.
+// Lists are joined with commas, matching the comma-separated list flags. An empty path reads nothing.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %s", err.Error())
+	}
+
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %s", path, err.Error())
+	}
+
+	values := map[string]string{}
+	var errs []error
+	for name, value := range document {
+		switch value := value.(type) {
+		case []interface{}:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				items = append(items, configValueString(item))
+			}
+			values[name] = strings.Join(items, ",")
+		case map[string]interface{}:
+			errs = append(errs, fmt.Errorf("config file %s: %s: must be a scalar or a list", path, name))
+		default:
+			values[name] = configValueString(value)
+		}
+	}
+	return values, errors.Join(errs...)
+}
+
+// configValueString formats a decoded YAML scalar the way the matching flag parses it.
+func configValueString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		if value == float64(int64(value)) {
+			return strconv.FormatInt(int64(value), 10)
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// printConfig writes the effective value of every flag of fs to w as YAML, redacting secrets.
+func printConfig(w io.Writer, fs *flag.FlagSet) error {
+	effective := map[string]interface{}{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if cliOnlyFlags[f.Name] {
+			return
+		}
+		value := f.Value.(flag.Getter).Get()
+		if duration, ok := value.(time.Duration); ok {
+			value = duration.String()
+		}
+		if secretFlags[f.Name] && f.Value.String() != "" {
+			value = "REDACTED"
+		}
+		effective[f.Name] = value
+	})
+
+	data, err := yaml.Marshal(effective)
+	if err != nil {
+		return fmt.Errorf("could not marshal effective config: %s", err.Error())
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// validate checks the configuration and reports every invalid setting at once.
+func (parameters serverParameters) validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for name, port := range map[string]int{"httpsPort": parameters.httpsPort, "httpPort": parameters.httpPort} {
+		if port < 1 || port > 65535 {
+			invalid("%s: %d is not a valid port", name, port)
+		}
+	}
+	if parameters.httpsPort == parameters.httpPort {
+		invalid("httpsPort and httpPort must differ, both are %d", parameters.httpPort)
+	}
+	if parameters.maxRequestBytes <= 0 {
+		invalid("maxRequestBytes: must be positive, got %d", parameters.maxRequestBytes)
+	}
+	if parameters.maxInFlight < 0 {
+		invalid("maxInFlight: must not be negative, got %d", parameters.maxInFlight)
+	}
+	if parameters.metricsObjectLimit < 0 {
+		invalid("metricsObjectLimit: must not be negative, got %d", parameters.metricsObjectLimit)
+	}
+	if parameters.webhookTimeoutSeconds < 1 || parameters.webhookTimeoutSeconds > 30 {
+		invalid("webhookTimeoutSeconds: must be between 1 and 30, got %d", parameters.webhookTimeoutSeconds)
+	}
+	for name, timeout := range map[string]time.Duration{"readTimeout": parameters.readTimeout, "writeTimeout": parameters.writeTimeout, "idleTimeout": parameters.idleTimeout} {
+		if timeout < 0 {
+			invalid("%s: must not be negative, got %s", name, timeout)
+		}
+	}
+	if _, err := newLogger(io.Discard, parameters.logFormat, parameters.logLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if parameters.debugMaxBodyBytes < 0 {
+		invalid("debugMaxBodyBytes: must not be negative, got %d", parameters.debugMaxBodyBytes)
+	}
+	if parameters.debugSampleRate < 0 || parameters.debugSampleRate > 1 {
+		invalid("debugSampleRate: must be between 0 and 1, got %v", parameters.debugSampleRate)
+	}
+	if parameters.eventQPS <= 0 || parameters.eventBurst < 1 {
+		invalid("eventQPS and eventBurst: must be positive, got %v and %d", parameters.eventQPS, parameters.eventBurst)
+	}
+	if parameters.decisionLogFile != "" {
+		if parameters.decisionLogMaxBytes <= 0 || parameters.decisionLogMaxAge <= 0 || parameters.decisionLogQueue < 1 {
+			invalid("decisionLogMaxBytes, decisionLogMaxAge and decisionLogQueue: must be positive")
+		}
+		if parameters.decisionLogMaxBackups < 0 {
+			invalid("decisionLogMaxBackups: must not be negative, got %d", parameters.decisionLogMaxBackups)
+		}
+	}
+	if parameters.recentDecisions < 0 {
+		invalid("recentDecisions: must not be negative, got %d", parameters.recentDecisions)
+	}
+	if parameters.driftCheckInterval < 0 {
+		invalid("driftCheckInterval: must not be negative, got %s", parameters.driftCheckInterval)
+	}
+	if parameters.backfillInterval < 0 {
+		invalid("backfillInterval: must not be negative, got %s", parameters.backfillInterval)
+	}
+	if parameters.backfillInterval > 0 {
+		if parameters.backfillQPS <= 0 {
+			invalid("backfillQPS: must be positive, got %v", parameters.backfillQPS)
+		}
+		if _, err := parseMaintenanceWindow(parameters.backfillWindow); err != nil {
+			invalid("backfillWindow: %s", err.Error())
+		}
+	}
+	if parameters.coverageMetrics || parameters.backfillInterval > 0 {
+		for name, selector := range map[string]string{"namespaceSelector": parameters.namespaceSelector, "objectSelector": parameters.objectSelector} {
+			if _, err := labels.Parse(selector); err != nil {
+				invalid("%s: invalid selector %q: %s", name, selector, err.Error())
+			}
+		}
+	}
+	if parameters.cloudEventsURL != "" {
+		if u, err := url.Parse(parameters.cloudEventsURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("cloudEventsURL: must be an http or https URL, got %q", parameters.cloudEventsURL)
+		}
+		for _, action := range strings.Split(parameters.cloudEventsActions, ",") {
+			switch strings.TrimSpace(action) {
+			case decisionMutated, decisionUnchanged, decisionIgnored, decisionDenied:
+			default:
+				invalid("cloudEventsActions: unknown action %q", action)
+			}
+		}
+		if parameters.cloudEventsQueue < 1 || parameters.cloudEventsAttempts < 1 || parameters.cloudEventsBackoff <= 0 {
+			invalid("cloudEventsQueue, cloudEventsAttempts and cloudEventsBackoff: must be positive")
+		}
+	}
+	if parameters.traceSampleRatio < 0 || parameters.traceSampleRatio > 1 {
+		invalid("traceSampleRatio: must be between 0 and 1, got %v", parameters.traceSampleRatio)
+	}
+
+	switch parameters.certMode {
+	case certModeFile:
+		if parameters.certFile == "" || parameters.keyFile == "" {
+			invalid("tlsCertFile and tlsKeyFile are required with certMode %s", certModeFile)
+		}
+	case certModeSelfSigned:
+		if parameters.serviceName == "" || parameters.serviceNamespace == "" || parameters.certSecretName == "" {
+			invalid("serviceName, serviceNamespace and certSecretName are required with certMode %s", certModeSelfSigned)
+		}
+	default:
+		invalid("certMode: must be %s or %s, got %q", certModeFile, certModeSelfSigned, parameters.certMode)
+	}
+
+	if parameters.registerWebhook {
+		if _, err := buildWebhookConfiguration(parameters, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if parameters.unregisterOnShutdown && !parameters.registerWebhook {
+		invalid("unregisterOnShutdown requires registerWebhook")
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// writeConfigFile writes a config file for the test and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// lookupMap returns a lookupEnv func reading the environment variables from env.
+func lookupMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+// TestLoadConfigPrecedence tests that flags override environment variables, which override the config file.
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+httpsPort: 8443
+httpPort: 8090
+logLevel: debug
+objectSelector: team=payments
+maxInFlight: 16
+debugRedactPaths:
+  - spec.a
+  - spec.b
+`)
+	env := map[string]string{
+		"TOLERATION_WEBHOOK_CONFIG":          path,
+		"TOLERATION_WEBHOOK_HTTP_PORT":       "9191",
+		"TOLERATION_WEBHOOK_MAX_IN_FLIGHT":   "8",
+		"TOLERATION_WEBHOOK_OBJECT_SELECTOR": "",
+	}
+	args := []string{"--maxInFlight=4"}
+
+	parameters, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), args, lookupMap(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parameters.httpsPort != 8443 || parameters.logLevel != "debug" {
+		t.Errorf("Expected config file values, got httpsPort=%d logLevel=%s", parameters.httpsPort, parameters.logLevel)
+	}
+	if parameters.httpPort != 9191 {
+		t.Errorf("Expected environment variable to override config file, got httpPort=%d", parameters.httpPort)
+	}
+	if parameters.objectSelector != "" {
+		t.Errorf("Expected empty environment variable to clear config file value, got objectSelector=%s", parameters.objectSelector)
+	}
+	if parameters.maxInFlight != 4 {
+		t.Errorf("Expected flag to override environment variable, got maxInFlight=%d", parameters.maxInFlight)
+	}
+	if parameters.debugRedactPaths != "spec.a,spec.b" {
+		t.Errorf("Expected list to be joined, got %s", parameters.debugRedactPaths)
+	}
+	if parameters.webhookTimeoutSeconds != 30 {
+		t.Errorf("Expected default webhookTimeoutSeconds, got %d", parameters.webhookTimeoutSeconds)
+	}
+}
+
+// TestLoadConfigReportsAllErrors tests that every invalid setting is reported at once.
+func TestLoadConfigReportsAllErrors(t *testing.T) {
+	path := writeConfigFile(t, `
+httpsPort: 70000
+logFormat: xml
+unknownSetting: true
+`)
+	env := map[string]string{"TOLERATION_WEBHOOK_MAX_IN_FLIGHT": "many"}
+	args := []string{"--config=" + path, "--certMode=acme", "--debugSampleRate=2"}
+
+	_, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), args, lookupMap(env))
+	if err == nil {
+		t.Fatal("Expected an invalid configuration error")
+	}
+	for _, expected := range []string{"httpsPort", "xml", "unknownSetting", "TOLERATION_WEBHOOK_MAX_IN_FLIGHT", "certMode", "debugSampleRate"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s, got:\n%s", expected, err.Error())
+		}
+	}
+}
+
+// TestLoadConfigPolicyFile tests that the toleration of --policyFile is loaded and an invalid policy is reported.
+func TestLoadConfigPolicyFile(t *testing.T) {
+	path := writeConfigFile(t, `
+apiVersion: toleration-webhook.andreistefanciprian.github.io/v1alpha1
+kind: TolerationPolicy
+spec:
+  toleration:
+    key: dedicated
+    effect: NoSchedule
+`)
+	parameters, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--policyFile=" + path}, lookupMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	if parameters.policy != expected {
+		t.Errorf("Expected %+v, got %+v", expected, parameters.policy)
+	}
+
+	invalid := writeConfigFile(t, "kind: Secret\n")
+	if _, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--policyFile=" + invalid}, lookupMap(nil)); err == nil || !strings.Contains(err.Error(), "policyFile") {
+		t.Errorf("Expected an invalid policyFile error, got %v", err)
+	}
+}
+
+// TestPrintConfig tests that the effective configuration is printed as YAML keyed by flag name.
+func TestPrintConfig(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	parameters, err := loadConfig(fs, []string{"--print-config", "--httpsPort=8443"}, lookupMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parameters.printConfig {
+		t.Error("Expected printConfig to be set")
+	}
+
+	var out bytes.Buffer
+	if err := printConfig(&out, fs); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"httpsPort: 8443\n", "readTimeout: 0s\n", "logFormat: json\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in printed config:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "print-config") {
+		t.Errorf("Expected print-config to be left out of printed config:\n%s", out.String())
+	}
+}
+
+// TestEnvName tests the environment variable names derived from flag names.
+func TestEnvName(t *testing.T) {
+	for flagName, expected := range map[string]string{
+		"httpsPort":         "TOLERATION_WEBHOOK_HTTPS_PORT",
+		"tlsCertFile":       "TOLERATION_WEBHOOK_TLS_CERT_FILE",
+		"debugMaxBodyBytes": "TOLERATION_WEBHOOK_DEBUG_MAX_BODY_BYTES",
+		"print-config":      "TOLERATION_WEBHOOK_PRINT_CONFIG",
+	} {
+		if name := envName(flagName); name != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, flagName, name)
+		}
+	}
+}
+
+// TestPrintConfigRedactsSecrets tests that --print-config does not print secret values.
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if _, err := loadConfig(fs, []string{"--cloudEventsSigningKey=secret"}, lookupMap(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := printConfig(&out, fs); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "secret") || !strings.Contains(out.String(), "cloudEventsSigningKey: REDACTED") {
+		t.Errorf("Expected the signing key to be redacted:\n%s", out.String())
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Compliance values of the toleration_webhook_workloads status label.
+const (
+	coverageCompliant    = "compliant"
+	coverageNonCompliant = "non_compliant"
+)
+
+// coverageCollector reports how many supported workloads in the namespaces the webhook applies to carry the toleration.
+// Workloads are read from informer caches when Prometheus scrapes, so the counts include workloads created
+// before the webhook existed or while it failed open.
+type coverageCollector struct {
+	namespaces        corelisters.NamespaceLister
+	workloads         map[string]cache.GenericLister // by kind
+	synced            []cache.InformerSynced
+	namespaceSelector labels.Selector
+	objectSelector    labels.Selector
+	desc              *prometheus.Desc
+}
+
+// newCoverageCollector returns a coverage collector for the namespaces and objects matching the selectors,
+// registering its informers in factory. The factory must be started for the collector to report anything.
+func newCoverageCollector(factory informers.SharedInformerFactory, namespaceSelector, objectSelector string) (*coverageCollector, error) {
+	c := &coverageCollector{
+		workloads: map[string]cache.GenericLister{},
+		desc: prometheus.NewDesc(
+			"toleration_webhook_workloads",
+			"Number of supported workloads in the namespaces the webhook applies to, by namespace, kind and toleration compliance",
+			[]string{"namespace", "kind", "status"}, nil,
+		),
+	}
+	var err error
+	if c.namespaceSelector, err = labels.Parse(namespaceSelector); err != nil {
+		return nil, fmt.Errorf("invalid namespace selector %q: %s", namespaceSelector, err.Error())
+	}
+	if c.objectSelector, err = labels.Parse(objectSelector); err != nil {
+		return nil, fmt.Errorf("invalid object selector %q: %s", objectSelector, err.Error())
+	}
+
+	namespaceInformer := factory.Core().V1().Namespaces()
+	c.namespaces = namespaceInformer.Lister()
+	c.synced = append(c.synced, namespaceInformer.Informer().HasSynced)
+	for _, supported := range supportedKinds {
+		informer, err := factory.ForResource(appsv1.SchemeGroupVersion.WithResource(supported.resource))
+		if err != nil {
+			return nil, fmt.Errorf("could not watch %s: %s", supported.resource, err.Error())
+		}
+		c.workloads[supported.kind] = informer.Lister()
+		c.synced = append(c.synced, informer.Informer().HasSynced)
+	}
+	return c, nil
+}
+
+// waitForSync waits until the informer caches are filled, returning false if ctx is done first.
+func (c *coverageCollector) waitForSync(ctx context.Context) bool {
+	return cache.WaitForCacheSync(ctx.Done(), c.synced...)
+}
+
+// Describe implements prometheus.Collector.
+func (c *coverageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector. Nothing is reported until the informer caches are synced.
+func (c *coverageCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, synced := range c.synced {
+		if !synced() {
+			return
+		}
+	}
+
+	namespaces, err := c.namespaces.List(c.namespaceSelector)
+	if err != nil {
+		return
+	}
+	for _, namespace := range namespaces {
+		for kind, lister := range c.workloads {
+			objects, err := lister.ByNamespace(namespace.Name).List(c.objectSelector)
+			if err != nil {
+				continue
+			}
+			counts := map[string]float64{coverageCompliant: 0, coverageNonCompliant: 0}
+			for _, object := range objects {
+				if tolerationExists(object, toleration) {
+					counts[coverageCompliant]++
+				} else {
+					counts[coverageNonCompliant]++
+				}
+			}
+			for status, count := range counts {
+				ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, count, namespace.Name, kind, status)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestCoverageCollector tests workloads are counted by compliance in the namespaces and objects matching the selectors.
+func TestCoverageCollector(t *testing.T) {
+	namespace := func(name string, labels map[string]string) runtime.Object {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	objectMeta := func(namespace, name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": name}}
+	}
+	podSpec := func(tolerations ...corev1.Toleration) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Tolerations: tolerations}}
+	}
+	enabled := map[string]string{"toleration-webhook": "enabled"}
+
+	client := fake.NewSimpleClientset(
+		namespace("foo", enabled),
+		namespace("bar", enabled),
+		namespace("disabled", nil),
+		&appsv1.Deployment{ObjectMeta: objectMeta("foo", "compliant"), Spec: appsv1.DeploymentSpec{Template: podSpec(toleration)}},
+		&appsv1.Deployment{ObjectMeta: objectMeta("foo", "non-compliant"), Spec: appsv1.DeploymentSpec{Template: podSpec()}},
+		&appsv1.Deployment{ObjectMeta: objectMeta("foo", "excluded"), Spec: appsv1.DeploymentSpec{Template: podSpec()}},
+		&appsv1.DaemonSet{ObjectMeta: objectMeta("bar", "other-toleration"), Spec: appsv1.DaemonSetSpec{Template: podSpec(corev1.Toleration{Key: "Other"})}},
+		&appsv1.DaemonSet{ObjectMeta: objectMeta("disabled", "ignored"), Spec: appsv1.DaemonSetSpec{Template: podSpec()}},
+	)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	collector, err := newCoverageCollector(factory, "toleration-webhook=enabled", "app!=excluded")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("Expected no metrics before the informers are synced, got %d", count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	factory.Start(ctx.Done())
+	if !collector.waitForSync(ctx) {
+		t.Fatal("Informers did not sync")
+	}
+
+	expected := `
+# HELP toleration_webhook_workloads Number of supported workloads in the namespaces the webhook applies to, by namespace, kind and toleration compliance
+# TYPE toleration_webhook_workloads gauge
+toleration_webhook_workloads{kind="DaemonSet",namespace="bar",status="compliant"} 0
+toleration_webhook_workloads{kind="DaemonSet",namespace="bar",status="non_compliant"} 1
+toleration_webhook_workloads{kind="DaemonSet",namespace="foo",status="compliant"} 0
+toleration_webhook_workloads{kind="DaemonSet",namespace="foo",status="non_compliant"} 0
+toleration_webhook_workloads{kind="Deployment",namespace="bar",status="compliant"} 0
+toleration_webhook_workloads{kind="Deployment",namespace="bar",status="non_compliant"} 0
+toleration_webhook_workloads{kind="Deployment",namespace="foo",status="compliant"} 1
+toleration_webhook_workloads{kind="Deployment",namespace="foo",status="non_compliant"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCoverageCollectorInvalidSelector tests invalid selectors are rejected.
+func TestCoverageCollectorInvalidSelector(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	if _, err := newCoverageCollector(factory, "a in (", ""); err == nil {
+		t.Error("Expected an invalid namespace selector error")
+	}
+}
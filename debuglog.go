@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"k8s.io/api/admission/v1beta1"
+)
+
+const redactedValue = "REDACTED"
+
+// secretAnnotationPattern matches annotation keys that are likely to hold credentials.
+// last-applied-configuration is included because it embeds a full copy of the object, env values included.
+var secretAnnotationPattern = regexp.MustCompile(`(?i)secret|token|password|passwd|credential|api-?key|private|last-applied-configuration`)
+
+// bodyLogger logs the AdmissionReview request, response and decoded patch of sampled requests.
+type bodyLogger struct {
+	redactPaths [][]string // additional dotted JSON paths to redact, "*" matches any key or list index
+	maxBytes    int        // maximum size of each logged body, larger bodies are truncated
+	sampleRate  float64    // fraction of requests to log, between 0 and 1
+}
+
+// newBodyLogger returns a bodyLogger redacting the given comma-separated dotted JSON paths,
+// such as "request.object.spec.template.spec.containers.*.args".
+func newBodyLogger(redactPaths string, maxBytes int, sampleRate float64) *bodyLogger {
+	logger := &bodyLogger{maxBytes: maxBytes, sampleRate: sampleRate}
+	for _, path := range strings.Split(redactPaths, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			logger.redactPaths = append(logger.redactPaths, strings.Split(path, "."))
+		}
+	}
+	return logger
+}
+
+// middleware returns a mux middleware that captures and logs the bodies of sampled requests at debug level.
+// Bodies are not captured when the debug level is disabled.
+func (l *bodyLogger) middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l.sampleRate <= 0 || rand.Float64() >= l.sampleRate || !slog.Default().Enabled(r.Context(), slog.LevelDebug) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requestBody, err := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(requestBody), &errorReader{err: err}))
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			l.log(requestBody, recorder.body.Bytes())
+		})
+	}
+}
+
+// log redacts, truncates and logs the request and response bodies of an admission request.
+// The patch is logged decoded and redacted on its own, and left out of the response where it is base64 encoded
+// and would escape redaction.
+func (l *bodyLogger) log(requestBody, responseBody []byte) {
+	var admissionReviewResponse v1beta1.AdmissionReview
+	var uid string
+	var patch []byte
+	if err := json.Unmarshal(responseBody, &admissionReviewResponse); err == nil && admissionReviewResponse.Response != nil {
+		uid = string(admissionReviewResponse.Response.UID)
+		patch = admissionReviewResponse.Response.Patch
+		admissionReviewResponse.Response.Patch = nil
+		if withoutPatch, err := json.Marshal(admissionReviewResponse); err == nil {
+			responseBody = withoutPatch
+		}
+	}
+
+	slog.Debug("Admission review bodies",
+		"uid", uid,
+		"request", l.redact(requestBody),
+		"response", l.redact(responseBody),
+		"patch", l.redact(patch),
+	)
+}
+
+// redact removes sensitive values from a JSON document and truncates it to maxBytes.
+// Documents that are not valid JSON are logged truncated only.
+func (l *bodyLogger) redact(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err == nil {
+		redactSecrets(document)
+		for _, path := range l.redactPaths {
+			redactPath(document, path)
+		}
+		if redacted, err := json.Marshal(document); err == nil {
+			body = redacted
+		}
+	}
+
+	if l.maxBytes > 0 && len(body) > l.maxBytes {
+		return string(body[:l.maxBytes]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+// redactSecrets walks a decoded JSON document and redacts container env values and secret-like annotations.
+// JSON patch operations on annotations are redacted the same way as annotations found in objects.
+func redactSecrets(node interface{}) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			switch {
+			case key == "env":
+				redactEnvValues(value)
+			case key == "annotations":
+				redactAnnotations(value)
+			case key == "value" && strings.HasSuffix(stringValue(node["path"]), "/annotations"):
+				redactAnnotations(value)
+			default:
+				redactSecrets(value)
+			}
+		}
+	case []interface{}:
+		for _, item := range node {
+			redactSecrets(item)
+		}
+	}
+}
+
+// redactEnvValues redacts the literal values of a container env list, valueFrom references are kept.
+func redactEnvValues(env interface{}) {
+	vars, ok := env.([]interface{})
+	if !ok {
+		return
+	}
+	for _, envVar := range vars {
+		if envVar, ok := envVar.(map[string]interface{}); ok {
+			if _, ok := envVar["value"]; ok {
+				envVar["value"] = redactedValue
+			}
+		}
+	}
+}
+
+// redactAnnotations redacts the values of annotations whose key looks like it holds a credential.
+func redactAnnotations(annotations interface{}) {
+	if annotations, ok := annotations.(map[string]interface{}); ok {
+		for key := range annotations {
+			if secretAnnotationPattern.MatchString(key) {
+				annotations[key] = redactedValue
+			}
+		}
+	}
+}
+
+// redactPath redacts the value found at a dotted JSON path, "*" matches any key or list index.
+func redactPath(node interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	last := len(path) == 1
+
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			if path[0] != "*" && path[0] != key {
+				continue
+			}
+			if last {
+				node[key] = redactedValue
+			} else {
+				redactPath(value, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, item := range node {
+			if path[0] != "*" && path[0] != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				node[i] = redactedValue
+			} else {
+				redactPath(item, path[1:])
+			}
+		}
+	}
+}
+
+// stringValue returns value when it is a string, and an empty string otherwise.
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// responseRecorder is an http.ResponseWriter that keeps a copy of the response body.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// errorReader is an io.Reader that always fails with err, or reports EOF when err is nil.
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	if r.err == nil {
+		return 0, io.EOF
+	}
+	return 0, r.err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestBodyLoggerRedact tests that sensitive values are redacted from logged bodies.
+func TestBodyLoggerRedact(t *testing.T) {
+	testCases := []struct {
+		description  string
+		redactPaths  string
+		maxBytes     int
+		body         string
+		expectedBody string
+	}{
+		{
+			description:  "env values",
+			body:         `{"env":[{"name":"PASSWORD","value":"hunter2"},{"name":"FROM_SECRET","valueFrom":{"secretKeyRef":{"key":"k","name":"s"}}}]}`,
+			expectedBody: `{"env":[{"name":"PASSWORD","value":"REDACTED"},{"name":"FROM_SECRET","valueFrom":{"secretKeyRef":{"key":"k","name":"s"}}}]}`,
+		},
+		{
+			description:  "secret-like annotations",
+			body:         `{"metadata":{"annotations":{"api-token":"abc","kubectl.kubernetes.io/last-applied-configuration":"{}","team":"platform"}}}`,
+			expectedBody: `{"metadata":{"annotations":{"api-token":"REDACTED","kubectl.kubernetes.io/last-applied-configuration":"REDACTED","team":"platform"}}}`,
+		},
+		{
+			description:  "annotations in a JSON patch",
+			body:         `[{"op":"replace","path":"/metadata/annotations","value":{"db-password":"abc","updated_by":"tolerationWebhook"}}]`,
+			expectedBody: `[{"op":"replace","path":"/metadata/annotations","value":{"db-password":"REDACTED","updated_by":"tolerationWebhook"}}]`,
+		},
+		{
+			description:  "configured paths",
+			redactPaths:  "spec.containers.*.args, spec.hostname",
+			body:         `{"spec":{"containers":[{"args":["--key=abc"],"name":"app"}],"hostname":"internal"}}`,
+			expectedBody: `{"spec":{"containers":[{"args":"REDACTED","name":"app"}],"hostname":"REDACTED"}}`,
+		},
+		{
+			description:  "truncation",
+			maxBytes:     10,
+			body:         `{"kind":"AdmissionReview"}`,
+			expectedBody: `{"kind":"A...(truncated)`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			logger := newBodyLogger(testCase.redactPaths, testCase.maxBytes, 1)
+			if body := logger.redact([]byte(testCase.body)); body != testCase.expectedBody {
+				t.Errorf("Expected body %s, got %s", testCase.expectedBody, body)
+			}
+		})
+	}
+}
+
+// TestBodyLoggerMiddleware tests that the request, response and patch are logged without leaking secrets.
+func TestBodyLoggerMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	level := new(slog.LevelVar)
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: level})))
+	defer slog.SetDefault(defaultLogger)
+
+	// Bodies are only logged at debug level.
+	serve := func(request string) *httptest.ResponseRecorder {
+		handler := newBodyLogger("", 0, 1).middleware()(http.HandlerFunc(webhookHandler))
+		req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(request))
+		req.Header.Set("Content-Type", jsonContentType)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	serve(makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", ""))
+	if strings.Contains(logs.String(), "Admission review bodies") {
+		t.Errorf("Expected no bodies to be logged at info level, got %s", logs.String())
+	}
+	level.Set(slog.LevelDebug)
+
+	request := makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "")
+	request = strings.Replace(request, `"some_annotation": "some_value"`, `"api-token": "s3cr3t"`, 1)
+	request = strings.Replace(request, `"restartPolicy": "Always"`, `"restartPolicy": "Always", "containers": [{"name": "app", "env": [{"name": "PASSWORD", "value": "hunter2"}]}]`, 1)
+
+	rec := serve(request)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	if !strings.Contains(logs.String(), `"msg":"Admission review bodies"`) || !strings.Contains(logs.String(), `updated_by`) {
+		t.Errorf("Expected request, response and patch to be logged, got %s", logs.String())
+	}
+	// Base64 encoded values, such as an AdmissionResponse patch, are decoded so that secrets cannot hide in them.
+	logged := logs.String()
+	for _, encoded := range regexp.MustCompile(`[A-Za-z0-9+/]{16,}={0,2}`).FindAllString(logged, -1) {
+		if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			logged += "\n" + string(decoded)
+		}
+	}
+	for _, secret := range []string{"s3cr3t", "hunter2"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("Expected %s to be redacted from logs, got %s", secret, logged)
+		}
+	}
+}
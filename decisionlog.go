@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	decisionLogSink          = "file"
+	decisionLogFlushInterval = time.Second
+	decisionLogBackupSuffix  = ".20060102T150405.000"
+)
+
+// decisionLog writes admission decisions to a file as JSON lines.
+// Decisions are queued and written by a background goroutine, so Record never blocks on disk;
+// decisions arriving while the queue is full are dropped and counted.
+// The file is rotated once it reaches maxBytes or maxAge, keeping maxBackups rotated files.
+type decisionLog struct {
+	path       string
+	maxBytes   int64
+	maxAge     time.Duration
+	maxBackups int
+	now        func() time.Time
+
+	mu     sync.RWMutex // guards closed against Record sending on the closed queue
+	closed bool
+	queue  chan decision
+	done   chan struct{}
+
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	opened time.Time
+}
+
+// newDecisionLog opens or creates the decision log at path and starts writing queued decisions to it.
+func newDecisionLog(path string, maxBytes int64, maxAge time.Duration, maxBackups, queueSize int) (*decisionLog, error) {
+	l := &decisionLog{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+		queue:      make(chan decision, queueSize),
+		done:       make(chan struct{}),
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	go l.run()
+	return l, nil
+}
+
+// Record queues d to be written, dropping it when the queue is full or the log is closed.
+func (l *decisionLog) Record(d decision) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		RecordDroppedDecision(decisionLogSink)
+		return
+	}
+	select {
+	case l.queue <- d:
+	default:
+		RecordDroppedDecision(decisionLogSink)
+	}
+}
+
+// Close writes the queued decisions and closes the file. Decisions recorded afterwards are dropped.
+func (l *decisionLog) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+	<-l.done
+	if err := l.writer.Flush(); err != nil {
+		return fmt.Errorf("could not flush decision log: %s", err.Error())
+	}
+	return l.file.Close()
+}
+
+// run writes queued decisions until the queue is closed, flushing the buffer once the queue
+// is drained or every decisionLogFlushInterval.
+func (l *decisionLog) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(decisionLogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case d, ok := <-l.queue:
+			if !ok {
+				return
+			}
+			if err := l.write(d); err != nil {
+				slog.Error("Could not write decision log", "path", l.path, "error", err)
+			}
+			if len(l.queue) == 0 {
+				l.writer.Flush()
+			}
+		case <-ticker.C:
+			l.writer.Flush()
+			if l.size > 0 && l.now().Sub(l.opened) >= l.maxAge {
+				if err := l.rotate(); err != nil {
+					slog.Error("Could not rotate decision log", "path", l.path, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// write appends d as a JSON line, rotating the file first when it is full or too old.
+// A failed rotation is returned once d is written to the original file.
+func (l *decisionLog) write(d decision) error {
+	line, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	var rotateErr error
+	if l.size > 0 && (l.size+int64(len(line)) > l.maxBytes || l.now().Sub(l.opened) >= l.maxAge) {
+		rotateErr = l.rotate()
+	}
+	n, err := l.writer.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+// open opens the decision log for appending.
+func (l *decisionLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open decision log: %s", err.Error())
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not open decision log: %s", err.Error())
+	}
+	l.file, l.writer, l.size, l.opened = file, bufio.NewWriter(file), info.Size(), l.now()
+	return nil
+}
+
+// rotate renames the decision log with a timestamp suffix, opens a new one and removes the oldest rotated files.
+// When the rename or the new file fails, the decision log goes on writing to the original file.
+func (l *decisionLog) rotate() error {
+	if err := l.writer.Flush(); err != nil {
+		return fmt.Errorf("could not rotate decision log: %s", err.Error())
+	}
+	l.file.Close()
+	backup := l.path + l.now().UTC().Format(decisionLogBackupSuffix)
+	if err := os.Rename(l.path, backup); err != nil {
+		return l.reopen(fmt.Errorf("could not rotate decision log: %s", err.Error()))
+	}
+	if err := l.open(); err != nil {
+		if renameErr := os.Rename(backup, l.path); renameErr != nil {
+			return fmt.Errorf("%s, and could not restore it: %s", err.Error(), renameErr.Error())
+		}
+		return l.reopen(err)
+	}
+
+	// Timestamp suffixes sort chronologically.
+	backups, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > l.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("could not remove rotated decision log: %s", err.Error())
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// reopen opens the original decision log again after a failed rotation and returns the rotation error.
+func (l *decisionLog) reopen(rotateErr error) error {
+	if err := l.open(); err != nil {
+		return fmt.Errorf("%s, and could not reopen it: %s", rotateErr.Error(), err.Error())
+	}
+	return rotateErr
+}
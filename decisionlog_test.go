@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// readDecisions returns the decisions written to the decision log at path.
+func readDecisions(t *testing.T, path string) []decision {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var decisions []decision
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var d decision
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			t.Fatalf("Invalid decision log line %s: %s", scanner.Text(), err.Error())
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+// TestDecisionLog tests that admission decisions are written to the decision log as JSON lines.
+func TestDecisionLog(t *testing.T) {
+	useTestMetrics(t)
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	log, err := newDecisionLog(path, 1<<20, time.Hour, 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decisionSinks = []decisionSink{log}
+	t.Cleanup(func() { decisionSinks = nil })
+
+	for _, request := range []string{
+		makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", ""),
+		makeAdmissionRequest("Deployment", "UPDATE", "foo/test-dep", "SimulateNodeFailure"),
+		"{",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(request))
+		req.Header.Set("Content-Type", jsonContentType)
+		webhookHandler(httptest.NewRecorder(), req)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	decisions := readDecisions(t, path)
+	if len(decisions) != 3 {
+		t.Fatalf("Expected 3 decisions, got %d", len(decisions))
+	}
+	mutated := decisions[0]
+	if mutated.Action != decisionMutated || mutated.Kind != "DaemonSet" || mutated.Namespace != "foo" || mutated.Name != "test-ds" ||
+		mutated.Operation != "CREATE" || mutated.Rule != toleration.Key || mutated.UID != "f0b23c24-35f6-42a3-99e3-aa4ccab85f91" {
+		t.Errorf("Unexpected mutated decision %+v", mutated)
+	}
+	var patch []patchOperation
+	if err := json.Unmarshal(mutated.Patch, &patch); err != nil || len(patch) != 2 || patch[0].Path != "/spec/template/spec/tolerations" {
+		t.Errorf("Expected the decoded patch, got %s", mutated.Patch)
+	}
+	if decisions[1].Action != decisionUnchanged || decisions[1].Patch != nil {
+		t.Errorf("Unexpected unchanged decision %+v", decisions[1])
+	}
+	if decisions[2].Action != decisionDenied || decisions[2].Reason == "" {
+		t.Errorf("Unexpected denied decision %+v", decisions[2])
+	}
+}
+
+// TestDecisionLogRotation tests that the decision log rotates by size and age and keeps maxBackups files.
+func TestDecisionLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	log := &decisionLog{path: path, maxBytes: 130, maxAge: time.Hour, maxBackups: 2, now: func() time.Time { return now }}
+	if err := log.open(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := decision{Time: now, UID: "uid", Action: decisionMutated}
+	for i := 0; i < 3; i++ {
+		if err := log.write(d); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	// Two 63 byte decisions fit in 130 bytes, the third one rotates the log.
+	if backups, _ := filepath.Glob(path + ".*"); len(backups) != 1 {
+		t.Errorf("Expected 1 rotated file after reaching maxBytes, got %v", backups)
+	}
+
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Hour)
+		if err := log.write(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if backups, _ := filepath.Glob(path + ".*"); len(backups) != 2 {
+		t.Errorf("Expected maxBackups 2 rotated files after reaching maxAge, got %v", backups)
+	}
+	log.writer.Flush()
+	if decisions := readDecisions(t, path); len(decisions) != 1 {
+		t.Errorf("Expected 1 decision in the current file, got %d", len(decisions))
+	}
+}
+
+// TestDecisionLogRotationFailure tests that the decision log goes on writing to the original file when it cannot be rotated.
+func TestDecisionLogRotationFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	log := &decisionLog{path: path, maxBytes: 70, maxAge: time.Hour, maxBackups: 2, now: func() time.Time { return now }}
+	if err := log.open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A non-empty directory in the way of the rotated file makes the rename fail.
+	blocker := path + now.UTC().Format(decisionLogBackupSuffix)
+	if err := os.MkdirAll(filepath.Join(blocker, "blocker"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	d := decision{Time: now, UID: "uid", Action: decisionMutated}
+	if err := log.write(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.write(d); err == nil {
+		t.Fatal("Expected the rotation to fail")
+	}
+	if err := log.write(d); err == nil {
+		t.Fatal("Expected the rotation to fail again")
+	}
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.write(d); err != nil {
+		t.Fatal(err)
+	}
+	log.writer.Flush()
+
+	if decisions := readDecisions(t, blocker); len(decisions) != 3 {
+		t.Errorf("Expected the 3 decisions written while rotation failed in the rotated file, got %d", len(decisions))
+	}
+	if decisions := readDecisions(t, path); len(decisions) != 1 {
+		t.Errorf("Expected 1 decision in the current file, got %d", len(decisions))
+	}
+}
+
+// TestDecisionLogDrops tests that decisions are dropped and counted instead of blocking when the queue is full.
+func TestDecisionLogDrops(t *testing.T) {
+	useTestMetrics(t)
+	log := &decisionLog{queue: make(chan decision, 1)}
+
+	log.Record(decision{UID: "first"})
+	log.Record(decision{UID: "second"})
+
+	if dropped := testutil.ToFloat64(metrics.droppedDecisions.WithLabelValues(decisionLogSink)); dropped != 1 {
+		t.Errorf("Expected 1 dropped decision, got %v", dropped)
+	}
+}
+
+// TestDecisionLogRecordAfterClose tests that decisions recorded after Close are dropped instead of panicking.
+func TestDecisionLogRecordAfterClose(t *testing.T) {
+	useTestMetrics(t)
+	log, err := newDecisionLog(filepath.Join(t.TempDir(), "decisions.jsonl"), 1<<20, time.Hour, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Errorf("Expected closing twice to succeed, got %s", err.Error())
+	}
+
+	log.Record(decision{UID: "late"})
+	if dropped := testutil.ToFloat64(metrics.droppedDecisions.WithLabelValues(decisionLogSink)); dropped != 1 {
+		t.Errorf("Expected the late decision to be dropped, got %v", dropped)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// decision records an admission decision for the decision sinks.
+type decision struct {
+	Time      time.Time       `json:"time"`
+	UID       types.UID       `json:"uid"`
+	User      string          `json:"user,omitempty"`
+	Operation string          `json:"operation,omitempty"`
+	Kind      string          `json:"kind,omitempty"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Rule      string          `json:"rule,omitempty"`
+	Action    string          `json:"action"`
+	Patch     json.RawMessage `json:"patch,omitempty"`
+	Warnings  []string        `json:"warnings,omitempty"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+// decisionSink receives admission decisions. Record is called on the admission path and must not block.
+type decisionSink interface {
+	Record(d decision)
+}
+
+// decisionSinks are the configured sinks every admission decision is sent to.
+var decisionSinks []decisionSink
+
+// newDecision returns the decision of response to req, which is nil when the request could not be decoded.
+// The namespace and name come from the admitted object, since the request name is empty for generated names.
+// The patch is redacted like logged bodies, since every sink stores or serves it as is.
+func newDecision(req *v1beta1.AdmissionRequest, response *v1beta1.AdmissionResponse, action string) decision {
+	d := decision{
+		Time:     time.Now().UTC(),
+		UID:      response.UID,
+		Rule:     response.AuditAnnotations[auditKeyRule],
+		Action:   action,
+		Patch:    redactPatch(response.Patch),
+		Warnings: response.Warnings,
+	}
+	if response.Result != nil {
+		d.Reason = response.Result.Message
+	}
+	if req == nil {
+		return d
+	}
+
+	d.User, d.Operation, d.Kind = req.UserInfo.Username, string(req.Operation), req.Kind.Kind
+	d.Namespace, d.Name = req.Namespace, req.Name
+	var object metav1.PartialObjectMetadata
+	if json.Unmarshal(req.Object.Raw, &object) == nil {
+		if object.Namespace != "" {
+			d.Namespace = object.Namespace
+		}
+		if object.Name != "" {
+			d.Name = object.Name
+		}
+	}
+	return d
+}
+
+// redactPatch returns the JSON patch with its secrets redacted, see redactSecrets.
+// A patch that cannot be decoded is dropped rather than recorded unredacted.
+func redactPatch(patch []byte) json.RawMessage {
+	if len(patch) == 0 {
+		return nil
+	}
+	var operations interface{}
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil
+	}
+	redactSecrets(operations)
+	redacted, err := json.Marshal(operations)
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+// recordDecision sends d to every decision sink.
+func recordDecision(d decision) {
+	for _, sink := range decisionSinks {
+		sink.Record(d)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Drift checks of the MutatingWebhookConfiguration.
+const (
+	driftCheckConfiguration     = "configuration"
+	driftCheckCABundle          = "caBundle"
+	driftCheckService           = "service"
+	driftCheckRules             = "rules"
+	driftCheckNamespaceSelector = "namespaceSelector"
+)
+
+var driftChecks = []string{driftCheckConfiguration, driftCheckCABundle, driftCheckService, driftCheckRules, driftCheckNamespaceSelector}
+
+// driftCheck is the result of a drift check, with a message explaining the drift.
+type driftCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// driftDetector periodically verifies that the MutatingWebhookConfiguration still sends admission requests
+// for every supported kind to this webhook, with a caBundle trusting the served certificate.
+// With failurePolicy Ignore a drifted configuration silently turns the webhook off.
+type driftDetector struct {
+	client            kubernetes.Interface
+	parameters        serverParameters
+	servedCertificate func() (*tls.Certificate, error)
+
+	mu     sync.Mutex
+	checks []driftCheck
+}
+
+// newDriftDetector returns a drift detector for the configuration named in parameters.
+// servedCertificate returns the certificate the https server currently serves.
+func newDriftDetector(client kubernetes.Interface, parameters serverParameters, servedCertificate func() (*tls.Certificate, error)) *driftDetector {
+	return &driftDetector{client: client, parameters: parameters, servedCertificate: servedCertificate}
+}
+
+// run checks the configuration every interval until ctx is done.
+func (d *driftDetector) run(ctx context.Context, interval time.Duration) {
+	wait.UntilWithContext(ctx, d.check, interval)
+}
+
+// check verifies the configuration once, recording the results in the drift metrics.
+func (d *driftDetector) check(ctx context.Context) {
+	checks := d.evaluate(ctx)
+	for _, check := range checks {
+		RecordDrift(check.Name, !check.OK)
+	}
+	d.mu.Lock()
+	d.checks = checks
+	d.mu.Unlock()
+}
+
+// results returns the results of the last check, nil before the first one.
+func (d *driftDetector) results() []driftCheck {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.checks
+}
+
+// evaluate runs every drift check against the current configuration.
+func (d *driftDetector) evaluate(ctx context.Context) []driftCheck {
+	results := map[string]error{}
+	configuration, err := d.client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, d.parameters.webhookConfigName, metav1.GetOptions{})
+	webhook := d.findWebhook(configuration)
+	switch {
+	case err != nil:
+		results[driftCheckConfiguration] = fmt.Errorf("could not get MutatingWebhookConfiguration %s: %s", d.parameters.webhookConfigName, err.Error())
+	case webhook == nil:
+		results[driftCheckConfiguration] = fmt.Errorf("MutatingWebhookConfiguration %s has no webhooks", d.parameters.webhookConfigName)
+	default:
+		results[driftCheckCABundle] = d.checkCABundle(webhook.ClientConfig.CABundle)
+		results[driftCheckService] = d.checkService(webhook.ClientConfig)
+		results[driftCheckRules] = checkRules(webhook.Rules)
+		results[driftCheckNamespaceSelector] = d.checkNamespaceSelector(webhook.NamespaceSelector)
+	}
+
+	var checks []driftCheck
+	for _, name := range driftChecks {
+		err, checked := results[name]
+		if !checked && results[driftCheckConfiguration] != nil {
+			err = fmt.Errorf("not checked, %s", results[driftCheckConfiguration].Error())
+		}
+		check := driftCheck{Name: name, OK: err == nil}
+		if err != nil {
+			check.Message = err.Error()
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// findWebhook returns the webhook of configuration pointing at this webhook's service, or else its first webhook.
+func (d *driftDetector) findWebhook(configuration *admissionregistrationv1.MutatingWebhookConfiguration) *admissionregistrationv1.MutatingWebhook {
+	if configuration == nil || len(configuration.Webhooks) == 0 {
+		return nil
+	}
+	for i, webhook := range configuration.Webhooks {
+		service := webhook.ClientConfig.Service
+		if service != nil && service.Name == d.parameters.serviceName && service.Namespace == d.parameters.serviceNamespace {
+			return &configuration.Webhooks[i]
+		}
+	}
+	return &configuration.Webhooks[0]
+}
+
+// checkCABundle verifies the served certificate for the service DNS name against caBundle.
+func (d *driftDetector) checkCABundle(caBundle []byte) error {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		return fmt.Errorf("caBundle holds no PEM certificates")
+	}
+	cert, err := d.servedCertificate()
+	if err != nil {
+		return fmt.Errorf("could not load served certificate: %s", err.Error())
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("could not parse served certificate: %s", err.Error())
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range cert.Certificate[1:] {
+		if intermediate, err := x509.ParseCertificate(der); err == nil {
+			intermediates.AddCert(intermediate)
+		}
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       d.parameters.serviceName + "." + d.parameters.serviceNamespace + ".svc",
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("caBundle does not verify the served certificate: %s", err.Error())
+	}
+	return nil
+}
+
+// checkService verifies the webhook calls this webhook's service on webhookPath.
+func (d *driftDetector) checkService(clientConfig admissionregistrationv1.WebhookClientConfig) error {
+	service := clientConfig.Service
+	if service == nil {
+		return fmt.Errorf("webhook calls URL %v instead of service %s/%s", clientConfig.URL, d.parameters.serviceNamespace, d.parameters.serviceName)
+	}
+	if service.Name != d.parameters.serviceName || service.Namespace != d.parameters.serviceNamespace {
+		return fmt.Errorf("webhook calls service %s/%s instead of %s/%s", service.Namespace, service.Name, d.parameters.serviceNamespace, d.parameters.serviceName)
+	}
+	if service.Path == nil || *service.Path != webhookPath {
+		path := ""
+		if service.Path != nil {
+			path = *service.Path
+		}
+		return fmt.Errorf("webhook calls path %q instead of %s", path, webhookPath)
+	}
+	return nil
+}
+
+// checkRules verifies the rules send CREATE and UPDATE requests of every supported kind.
+func checkRules(rules []admissionregistrationv1.RuleWithOperations) error {
+	var missing []string
+	for _, supported := range supportedKinds {
+		for _, operation := range []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update} {
+			if !rulesCover(rules, supported.resource, operation) {
+				missing = append(missing, string(operation)+" "+supported.resource)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("rules do not cover %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// rulesCover reports whether any of rules matches operation on apps/v1 resource.
+func rulesCover(rules []admissionregistrationv1.RuleWithOperations, resource string, operation admissionregistrationv1.OperationType) bool {
+	for _, rule := range rules {
+		if containsOrWildcard(rule.APIGroups, appsv1.GroupName) &&
+			containsOrWildcard(rule.APIVersions, appsv1.SchemeGroupVersion.Version) &&
+			coversResource(rule.Resources, resource) &&
+			containsOrWildcard(operationStrings(rule.Operations), string(operation)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNamespaceSelector verifies the webhook's namespace selector selects the same namespaces as the configured one.
+func (d *driftDetector) checkNamespaceSelector(selector *metav1.LabelSelector) error {
+	expected, err := metav1.ParseToLabelSelector(d.parameters.namespaceSelector)
+	if err != nil {
+		return err
+	}
+	actualRequirements, err := selectorRequirements(selector)
+	if err != nil {
+		return fmt.Errorf("invalid namespaceSelector: %s", err.Error())
+	}
+	expectedRequirements, err := selectorRequirements(expected)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(actualRequirements, expectedRequirements) {
+		return fmt.Errorf("namespaceSelector is %q instead of %q", labelSelectorString(selector), labelSelectorString(expected))
+	}
+	return nil
+}
+
+// selectorRequirements returns the requirements of selector, sorted and normalized so that selectors selecting
+// the same objects compare equal: a single value In is the same as =, and a single value NotIn the same as !=.
+// A nil selector selects everything, as the API server defaults it to an empty one.
+func selectorRequirements(selector *metav1.LabelSelector) ([]string, error) {
+	if selector == nil {
+		selector = &metav1.LabelSelector{}
+	}
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	requirements, _ := parsed.Requirements()
+	var normalized []string
+	for _, requirement := range requirements {
+		operator := requirement.Operator()
+		values := requirement.Values().List()
+		switch {
+		case len(values) == 1 && (operator == selection.In || operator == selection.DoubleEquals):
+			operator = selection.Equals
+		case len(values) == 1 && operator == selection.NotIn:
+			operator = selection.NotEquals
+		}
+		normalized = append(normalized, fmt.Sprintf("%s %s %s", requirement.Key(), operator, strings.Join(values, ",")))
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// labelSelectorString returns selector in its normalized string form.
+func labelSelectorString(selector *metav1.LabelSelector) string {
+	if selector == nil {
+		return ""
+	}
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return selector.String()
+	}
+	return parsed.String()
+}
+
+// containsOrWildcard reports whether values holds value or "*".
+func containsOrWildcard(values []string, value string) bool {
+	for _, v := range values {
+		if v == value || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// coversResource reports whether resources contains resource, "*", or the "*/*" and "<resource>/*" subresource wildcards.
+func coversResource(resources []string, resource string) bool {
+	for _, r := range resources {
+		if r == resource || r == "*" || r == "*/*" || r == resource+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// operationStrings returns operations as strings.
+func operationStrings(operations []admissionregistrationv1.OperationType) []string {
+	var values []string
+	for _, operation := range operations {
+		values = append(values, string(operation))
+	}
+	return values
+}
+
+// readyzHandler serves readiness in the kube-apiserver /readyz format, listing the drift checks of detector
+// when it is set. Drift is reported for detail only and does not fail readiness, since taking replicas
+// out of the service would not repair the configuration.
+func readyzHandler(detector *driftDetector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if detector != nil {
+			for _, check := range detector.results() {
+				if check.OK {
+					fmt.Fprintf(w, "[+]drift-%s ok\n", check.Name)
+				} else {
+					fmt.Fprintf(w, "[-]drift-%s: %s\n", check.Name, check.Message)
+				}
+			}
+		}
+		fmt.Fprintln(w, "readyz check passed")
+	}
+}
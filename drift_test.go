@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestDriftDetector tests each drift check against a configuration drifted in one way.
+func TestDriftDetector(t *testing.T) {
+	parameters := testWebhookParameters()
+	secretData, err := renewSelfSignedCert(nil, serviceDNSNames(parameters.serviceName, parameters.serviceNamespace), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(secretData[corev1.TLSCertKey], secretData[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, err := renewSelfSignedCert(nil, serviceDNSNames("other", "other"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		description string
+		drift       func(*admissionregistrationv1.MutatingWebhookConfiguration)
+		failed      []string
+	}{
+		{"in sync", func(*admissionregistrationv1.MutatingWebhookConfiguration) {}, nil},
+		{"deleted", nil, driftChecks},
+		{"stale caBundle", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			c.Webhooks[0].ClientConfig.CABundle = otherCA[caCertKey]
+		}, []string{driftCheckCABundle}},
+		{"other path", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			path := "/validate"
+			c.Webhooks[0].ClientConfig.Service.Path = &path
+		}, []string{driftCheckService}},
+		{"missing kind", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			c.Webhooks[0].Rules[0].Resources = []string{"deployments"}
+		}, []string{driftCheckRules}},
+		{"wildcard rules", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			c.Webhooks[0].Rules[0].Resources = []string{"*"}
+			c.Webhooks[0].Rules[0].Operations = []admissionregistrationv1.OperationType{admissionregistrationv1.OperationAll}
+		}, nil},
+		{"subresource wildcard rules", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			c.Webhooks[0].Rules[0].Resources = []string{"*/*"}
+		}, nil},
+		{"resource subresource wildcard rules", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			c.Webhooks[0].Rules[0].Resources = []string{"deployments/*", "daemonsets/*"}
+		}, nil},
+		{"changed namespaceSelector", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			c.Webhooks[0].NamespaceSelector = nil
+		}, []string{driftCheckNamespaceSelector}},
+		{"equivalent namespaceSelector", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			c.Webhooks[0].NamespaceSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "toleration-webhook", Operator: metav1.LabelSelectorOpIn, Values: []string{"enabled"}},
+			}}
+		}, nil},
+		{"narrower namespaceSelector", func(c *admissionregistrationv1.MutatingWebhookConfiguration) {
+			c.Webhooks[0].NamespaceSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "toleration-webhook", Operator: metav1.LabelSelectorOpIn, Values: []string{"enabled"}},
+				{Key: "team", Operator: metav1.LabelSelectorOpExists},
+			}}
+		}, []string{driftCheckNamespaceSelector}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			useTestMetrics(t)
+			client := fake.NewSimpleClientset()
+			if testCase.drift != nil {
+				configuration, err := buildWebhookConfiguration(parameters, secretData[caCertKey])
+				if err != nil {
+					t.Fatal(err)
+				}
+				testCase.drift(configuration)
+				client = fake.NewSimpleClientset(configuration)
+			}
+			detector := newDriftDetector(client, parameters, func() (*tls.Certificate, error) { return &cert, nil })
+			detector.check(context.Background())
+
+			failed := map[string]bool{}
+			for _, name := range testCase.failed {
+				failed[name] = true
+			}
+			for _, check := range detector.results() {
+				if check.OK == failed[check.Name] {
+					t.Errorf("Expected check %s ok=%v, got %+v", check.Name, !failed[check.Name], check)
+				}
+				drift := testutil.ToFloat64(metrics.configDrift.WithLabelValues(check.Name))
+				if (drift == 1) != failed[check.Name] {
+					t.Errorf("Expected check %s drift metric %v, got %v", check.Name, failed[check.Name], drift)
+				}
+			}
+		})
+	}
+}
+
+// TestReadyzHandler tests /readyz lists the drift checks without failing readiness.
+func TestReadyzHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	readyzHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "readyz check passed\n" {
+		t.Errorf("Expected readyz to pass without drift detection, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	detector := &driftDetector{checks: []driftCheck{
+		{Name: driftCheckConfiguration, OK: true},
+		{Name: driftCheckRules, Message: "rules do not cover CREATE daemonsets"},
+	}}
+	rec = httptest.NewRecorder()
+	readyzHandler(detector).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	expected := "[+]drift-configuration ok\n[-]drift-rules: rules do not cover CREATE daemonsets\nreadyz check passed\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != expected {
+		t.Errorf("Expected %q, got %d %q", expected, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	eventComponent             = "toleration-webhook"
+	eventReasonTolerationAdded = "TolerationAdded"
+)
+
+// eventRecorder records Events against mutated workloads, nil when --recordEvents is not set.
+var eventRecorder record.EventRecorder
+
+// newEventRecorder returns an event recorder writing to the cluster through client,
+// allowing burst Events per object before limiting them to qps.
+// The returned function stops the recorder once queued Events are sent.
+func newEventRecorder(client kubernetes.Interface, qps float32, burst int) (record.EventRecorder, func()) {
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{QPS: qps, BurstSize: burst})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+	return recorder, broadcaster.Shutdown
+}
+
+// recordTolerationEvent records a Normal Event on the workload of an admission request the tolerations were added to.
+// Dry-run requests are not recorded since the object is not persisted.
+func recordTolerationEvent(req *v1beta1.AdmissionRequest, targetObject runtime.Object, rule string, tolerations []corev1.Toleration) {
+	if req.DryRun != nil && *req.DryRun {
+		return
+	}
+	recordWorkloadTolerationEvent(req.Namespace, targetObject, rule, tolerations)
+}
+
+// recordWorkloadTolerationEvent records a Normal Event on the workload the tolerations were added to,
+// in namespace when the object leaves its namespace out.
+// Objects being created have no UID yet, so their Events refer to them by kind, namespace and name only,
+// and objects created with generateName have no name either, so they get no Event.
+func recordWorkloadTolerationEvent(namespace string, targetObject runtime.Object, rule string, tolerations []corev1.Toleration) {
+	if eventRecorder == nil {
+		return
+	}
+	object, err := meta.Accessor(targetObject)
+	if err != nil {
+		return
+	}
+	if object.GetName() == "" {
+		slog.Debug("Not recording event for an object without a name", "namespace", namespace, "generateName", object.GetGenerateName())
+		return
+	}
+	// Objects being created may leave their namespace to the request, the Event needs it.
+	if object.GetNamespace() == "" {
+		object.SetNamespace(namespace)
+	}
+	var keys []string
+	for _, toleration := range tolerations {
+		keys = append(keys, toleration.Key)
+	}
+	slog.Debug("Recording event", "namespace", object.GetNamespace(), "name", object.GetName(), "reason", eventReasonTolerationAdded)
+	eventRecorder.Eventf(targetObject, corev1.EventTypeNormal, eventReasonTolerationAdded,
+		"Added tolerations %s required by rule %s", strings.Join(keys, ", "), rule)
+}
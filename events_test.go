@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// TestRecordTolerationEvent tests that mutated workloads get a Normal Event and unchanged ones do not.
+func TestRecordTolerationEvent(t *testing.T) {
+	useTestMetrics(t)
+	client := fake.NewSimpleClientset()
+	recorder, stop := newEventRecorder(client, 1, 5)
+	eventRecorder = recorder
+	t.Cleanup(func() {
+		stop()
+		eventRecorder = nil
+	})
+
+	for _, request := range []string{
+		makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", ""),
+		makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "SimulateNodeFailure"),
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(request))
+		req.Header.Set("Content-Type", jsonContentType)
+		webhookHandler(httptest.NewRecorder(), req)
+	}
+
+	var events []corev1.Event
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		list, err := client.CoreV1().Events("foo").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		events = list.Items
+		return len(events) > 0, nil
+	})
+	if err != nil {
+		t.Fatalf("Expected an Event to be recorded: %s", err.Error())
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 Event, got %d", len(events))
+	}
+	event := events[0]
+	if event.Type != corev1.EventTypeNormal || event.Reason != eventReasonTolerationAdded || event.Source.Component != eventComponent {
+		t.Errorf("Expected a Normal %s Event from %s, got %s %s from %s", eventReasonTolerationAdded, eventComponent, event.Type, event.Reason, event.Source.Component)
+	}
+	if event.InvolvedObject.Kind != "DaemonSet" || event.InvolvedObject.Name != "test-ds" || event.InvolvedObject.Namespace != "foo" {
+		t.Errorf("Expected the Event on DaemonSet foo/test-ds, got %+v", event.InvolvedObject)
+	}
+	if !strings.Contains(event.Message, "SimulateNodeFailure") {
+		t.Errorf("Expected the Event message to name the toleration, got %q", event.Message)
+	}
+}
+
+// TestRecordTolerationEventDryRun tests that dry-run requests and objects without a name record nothing.
+func TestRecordTolerationEventDryRun(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(1)
+	eventRecorder = fakeRecorder
+	t.Cleanup(func() { eventRecorder = nil })
+
+	dryRun := true
+	request := &v1beta1.AdmissionRequest{Namespace: "foo", Operation: v1beta1.Create, DryRun: &dryRun}
+	daemonSet := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "test-ds"}}
+	recordTolerationEvent(request, daemonSet, toleration.Key, policyRules())
+	if len(fakeRecorder.Events) != 0 {
+		t.Errorf("Expected no Event for a dry-run request, got %q", <-fakeRecorder.Events)
+	}
+
+	request.DryRun = nil
+	recordTolerationEvent(request, daemonSet, toleration.Key, policyRules())
+	if event := <-fakeRecorder.Events; !strings.HasPrefix(event, "Normal TolerationAdded") || daemonSet.Namespace != "foo" {
+		t.Errorf("Expected a TolerationAdded Event in namespace foo, got %q in %q", event, daemonSet.Namespace)
+	}
+
+	// Objects created with generateName have no name to record the Event on.
+	generated := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{GenerateName: "test-ds-"}}
+	recordTolerationEvent(request, generated, toleration.Key, policyRules())
+	if len(fakeRecorder.Events) != 0 {
+		t.Errorf("Expected no Event for an object without a name, got %q", <-fakeRecorder.Events)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testNamespace returns a Namespace with the given labels.
+func testNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+// testDeployment returns a Deployment whose pod template has the given tolerations.
+func testDeployment(objectMeta metav1.ObjectMeta, tolerations ...corev1.Toleration) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: objectMeta, Spec: appsv1.DeploymentSpec{Template: testPodTemplate(tolerations...)}}
+}
+
+// testDaemonSet returns a DaemonSet whose pod template has the given tolerations.
+func testDaemonSet(objectMeta metav1.ObjectMeta, tolerations ...corev1.Toleration) *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{ObjectMeta: objectMeta, Spec: appsv1.DaemonSetSpec{Template: testPodTemplate(tolerations...)}}
+}
+
+// testPodTemplate returns a pod template with the given tolerations.
+func testPodTemplate(tolerations ...corev1.Toleration) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Tolerations: tolerations}}
+}
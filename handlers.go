@@ -1,29 +1,109 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/api/admission/v1beta1"
+)
 
 // webhookHandler is the HTTP handler function for the /mutate endpoint.
 func webhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Track in-flight requests and the request duration by kind, operation and outcome.
+	start := time.Now()
+	metrics.inFlight.Inc()
+	defer metrics.inFlight.Dec()
+	kind, operation := labelUnknown, labelUnknown
+	outcome := outcomeError
+	defer func() { RecordDuration(kind, operation, outcome, time.Since(start)) }()
+
+	// Trace the request, continuing the caller's trace when it sent a W3C traceparent header.
+	ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "admission", trace.WithSpanKind(trace.SpanKindServer))
+	defer func() {
+		span.SetAttributes(attribute.String(attributeDecision, outcome))
+		span.End()
+	}()
 
 	// Validate Request (Valid requests are POST with Content-Type: application/json)
 	if !validateRequest(w, r) {
+		RecordError(stageValidate)
+		outcome = outcomeInvalid
 		return
 	}
 
 	// Parse the AdmissionReview request and return it.
+	// Failures are reported as a denied AdmissionReview, so the API server records a decision rather than a call failure.
+	_, decodeSpan := tracer.Start(ctx, "decode")
 	admissionReviewReq, err := parseRequest(w, r)
+	endSpan(decodeSpan, err)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordError(stageParse)
+		outcome = decisionDenied
+		admissionReviewResponse := errorResponse(err)
+		slog.Warn("Admission request rejected", "uid", admissionReviewResponse.Response.UID, "decision", decisionDenied, "error", err)
+		recordDecision(newDecision(nil, admissionReviewResponse.Response, decisionDenied))
+		if err := encodeResponse(ctx, w, admissionReviewResponse); err != nil {
+			RecordError(stageSend)
+		}
 		return
 	}
+	setAdmissionUID(r.Context(), admissionReviewReq.Request.UID)
+	kind, operation = admissionReviewReq.Request.Kind.Kind, string(admissionReviewReq.Request.Operation)
+	span.SetAttributes(
+		attribute.String(attributeUID, string(admissionReviewReq.Request.UID)),
+		attribute.String(attributeOperation, operation),
+		attribute.String(attributeKind, kind),
+	)
 
 	// Build AdmissionReview response.
-	admissionReviewResponse, err := buildResponse(w, *admissionReviewReq)
+	admissionReviewResponse, err := buildResponse(ctx, *admissionReviewReq, toleration)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		RecordError(stageBuild)
+		outcome = decisionDenied
+		span.RecordError(err)
+		admissionReviewResponse := errorResponse(err)
+		recordDecision(newDecision(admissionReviewReq.Request, admissionReviewResponse.Response, decisionDenied))
+		if err := encodeResponse(ctx, w, admissionReviewResponse); err != nil {
+			RecordError(stageSend)
+		}
 		return
 	}
 
 	// Write the AdmissionReview response to the http response writer.
-	sendResponse(w, *admissionReviewResponse)
+	if err := encodeResponse(ctx, w, *admissionReviewResponse); err != nil {
+		RecordError(stageSend)
+		slog.Error("Could not send admission response", "uid", admissionReviewReq.Request.UID, "error", err)
+		return
+	}
+	outcome = responseOutcome(kind, admissionReviewResponse)
+	recordDecision(newDecision(admissionReviewReq.Request, admissionReviewResponse.Response, outcome))
+}
+
+// encodeResponse writes the AdmissionReview response within an encode span.
+func encodeResponse(ctx context.Context, w http.ResponseWriter, admissionReviewResponse v1beta1.AdmissionReview) error {
+	_, span := tracer.Start(ctx, "encode")
+	err := sendResponse(w, admissionReviewResponse)
+	endSpan(span, err)
+	return err
+}
+
+// responseOutcome returns the decision an AdmissionReview response carries.
+func responseOutcome(kind string, admissionReviewResponse *v1beta1.AdmissionReview) string {
+	_, supported := lookupKind(kind)
+	switch {
+	case !admissionReviewResponse.Response.Allowed:
+		return decisionDenied
+	case admissionReviewResponse.Response.Patch != nil:
+		return decisionMutated
+	case !supported:
+		return decisionIgnored
+	default:
+		return decisionUnchanged
+	}
 }
@@ -23,74 +23,74 @@ func TestWebhookHandler(t *testing.T) {
 			description:      "CREATE DaemonSet without toleration",
 			request:          makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", ""),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","auditAnnotations":{"action":"mutated","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure","tolerations-added":"[{\"key\":\"SimulateNodeFailure\",\"operator\":\"Exists\",\"effect\":\"NoExecute\"}]"},"warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}}`,
 		},
 		{
 			description:      "CREATE DaemonSet with toleration set to other toleration",
 			request:          makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", "TestToleration"),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiVGVzdFRvbGVyYXRpb24iLCJvcGVyYXRvciI6IkV4aXN0cyIsImVmZmVjdCI6Ik5vRXhlY3V0ZSJ9LHsia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiVGVzdFRvbGVyYXRpb24iLCJvcGVyYXRvciI6IkV4aXN0cyIsImVmZmVjdCI6Ik5vRXhlY3V0ZSJ9LHsia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","auditAnnotations":{"action":"mutated","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure","tolerations-added":"[{\"key\":\"SimulateNodeFailure\",\"operator\":\"Exists\",\"effect\":\"NoExecute\"}]"},"warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}}`,
 		},
 		{
 			description:      "CREATE DaemonSet with toleration set to target toleration",
 			request:          makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", "SimulateNodeFailure"),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"auditAnnotations":{"action":"unchanged","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure"}}}`,
 		},
 		{
 			description:      "UPDATE DaemonSet without toleration",
 			request:          makeAdmissionRequest("DaemonSet", "UPDATE", "foo/test-ds", ""),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","auditAnnotations":{"action":"mutated","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure","tolerations-added":"[{\"key\":\"SimulateNodeFailure\",\"operator\":\"Exists\",\"effect\":\"NoExecute\"}]"},"warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}}`,
 		},
 		{
 			description:      "UPDATE DaemonSet with toleration set to other toleration",
 			request:          makeAdmissionRequest("DaemonSet", "UPDATE", "foo/test-ds", "TestToleration"),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiVGVzdFRvbGVyYXRpb24iLCJvcGVyYXRvciI6IkV4aXN0cyIsImVmZmVjdCI6Ik5vRXhlY3V0ZSJ9LHsia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiVGVzdFRvbGVyYXRpb24iLCJvcGVyYXRvciI6IkV4aXN0cyIsImVmZmVjdCI6Ik5vRXhlY3V0ZSJ9LHsia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","auditAnnotations":{"action":"mutated","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure","tolerations-added":"[{\"key\":\"SimulateNodeFailure\",\"operator\":\"Exists\",\"effect\":\"NoExecute\"}]"},"warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}}`,
 		},
 		{
 			description:      "UPDATE DaemonSet with toleration set to target toleration",
 			request:          makeAdmissionRequest("DaemonSet", "UPDATE", "foo/test-ds", "SimulateNodeFailure"),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"auditAnnotations":{"action":"unchanged","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure"}}}`,
 		},
 		// Test Deployments
 		{
 			description:      "CREATE Deployment without toleration",
 			request:          makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", ""),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","warnings":["Deployment foo/test-dep does not have a toleration set.","Deployment foo/test-dep was updated with toleration."]}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","auditAnnotations":{"action":"mutated","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure","tolerations-added":"[{\"key\":\"SimulateNodeFailure\",\"operator\":\"Exists\",\"effect\":\"NoExecute\"}]"},"warnings":["Deployment foo/test-dep does not have a toleration set.","Deployment foo/test-dep was updated with toleration."]}}`,
 		},
 		{
 			description:      "CREATE Deployment with toleration set to other toleration",
 			request:          makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "TestToleration"),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiVGVzdFRvbGVyYXRpb24iLCJvcGVyYXRvciI6IkV4aXN0cyIsImVmZmVjdCI6Ik5vRXhlY3V0ZSJ9LHsia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","warnings":["Deployment foo/test-dep does not have a toleration set.","Deployment foo/test-dep was updated with toleration."]}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiVGVzdFRvbGVyYXRpb24iLCJvcGVyYXRvciI6IkV4aXN0cyIsImVmZmVjdCI6Ik5vRXhlY3V0ZSJ9LHsia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","auditAnnotations":{"action":"mutated","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure","tolerations-added":"[{\"key\":\"SimulateNodeFailure\",\"operator\":\"Exists\",\"effect\":\"NoExecute\"}]"},"warnings":["Deployment foo/test-dep does not have a toleration set.","Deployment foo/test-dep was updated with toleration."]}}`,
 		},
 		{
 			description:      "CREATE Deployment with toleration set to target toleration",
 			request:          makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "SimulateNodeFailure"),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"auditAnnotations":{"action":"unchanged","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure"}}}`,
 		},
 		{
 			description:      "UPDATE Deployment without toleration",
 			request:          makeAdmissionRequest("Deployment", "UPDATE", "foo/test-dep", ""),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","warnings":["Deployment foo/test-dep does not have a toleration set.","Deployment foo/test-dep was updated with toleration."]}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","auditAnnotations":{"action":"mutated","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure","tolerations-added":"[{\"key\":\"SimulateNodeFailure\",\"operator\":\"Exists\",\"effect\":\"NoExecute\"}]"},"warnings":["Deployment foo/test-dep does not have a toleration set.","Deployment foo/test-dep was updated with toleration."]}}`,
 		},
 		{
 			description:      "UPDATE Deployment with toleration set to other toleration",
 			request:          makeAdmissionRequest("Deployment", "UPDATE", "foo/test-dep", "TestToleration"),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiVGVzdFRvbGVyYXRpb24iLCJvcGVyYXRvciI6IkV4aXN0cyIsImVmZmVjdCI6Ik5vRXhlY3V0ZSJ9LHsia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","warnings":["Deployment foo/test-dep does not have a toleration set.","Deployment foo/test-dep was updated with toleration."]}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"patch":"W3sib3AiOiJyZXBsYWNlIiwicGF0aCI6Ii9zcGVjL3RlbXBsYXRlL3NwZWMvdG9sZXJhdGlvbnMiLCJ2YWx1ZSI6W3sia2V5IjoiVGVzdFRvbGVyYXRpb24iLCJvcGVyYXRvciI6IkV4aXN0cyIsImVmZmVjdCI6Ik5vRXhlY3V0ZSJ9LHsia2V5IjoiU2ltdWxhdGVOb2RlRmFpbHVyZSIsIm9wZXJhdG9yIjoiRXhpc3RzIiwiZWZmZWN0IjoiTm9FeGVjdXRlIn1dfSx7Im9wIjoicmVwbGFjZSIsInBhdGgiOiIvbWV0YWRhdGEvYW5ub3RhdGlvbnMiLCJ2YWx1ZSI6eyJzb21lX2Fubm90YXRpb24iOiJzb21lX3ZhbHVlIiwidXBkYXRlZF9ieSI6InRvbGVyYXRpb25XZWJob29rIn19XQ==","auditAnnotations":{"action":"mutated","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure","tolerations-added":"[{\"key\":\"SimulateNodeFailure\",\"operator\":\"Exists\",\"effect\":\"NoExecute\"}]"},"warnings":["Deployment foo/test-dep does not have a toleration set.","Deployment foo/test-dep was updated with toleration."]}}`,
 		},
 		{
 			description:      "UPDATE Deployment with toleration set to target toleration",
 			request:          makeAdmissionRequest("Deployment", "UPDATE", "foo/test-dep", "SimulateNodeFailure"),
 			expectedStatus:   http.StatusOK,
-			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true}}`,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"auditAnnotations":{"action":"unchanged","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure"}}}`,
 		},
 	}
 
@@ -171,3 +171,70 @@ func getTolerationPodSpec(tolerationKey string) string {
 		)
 	}
 }
+
+// TestWebhookHandlerErrors tests that failures are answered with well-formed AdmissionReview responses.
+func TestWebhookHandlerErrors(t *testing.T) {
+	testCases := []struct {
+		description      string
+		method           string
+		contentType      string
+		request          string
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			description:      "CREATE unsupported kind",
+			method:           http.MethodPost,
+			contentType:      jsonContentType,
+			request:          makeAdmissionRequest("StatefulSet", "CREATE", "foo/test-sts", ""),
+			expectedStatus:   http.StatusOK,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"auditAnnotations":{"action":"ignored","policy-hash":"319f89fb735e3d3d"}}}`,
+		},
+		{
+			description:      "Content-Type with parameters",
+			method:           http.MethodPost,
+			contentType:      "application/json; charset=utf-8",
+			request:          makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "SimulateNodeFailure"),
+			expectedStatus:   http.StatusOK,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true,"auditAnnotations":{"action":"unchanged","policy-hash":"319f89fb735e3d3d","rule":"SimulateNodeFailure"}}}`,
+		},
+		{
+			description:      "invalid Content-Type",
+			method:           http.MethodPost,
+			contentType:      "text/plain",
+			request:          makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", ""),
+			expectedStatus:   http.StatusOK,
+			expectedResponse: `{"response":{"uid":"","allowed":false,"status":{"metadata":{},"status":"Failure","message":"invalid content type \"text/plain\"","reason":"UnsupportedMediaType","code":415}}}`,
+		},
+		{
+			description:      "AdmissionReview without request",
+			method:           http.MethodPost,
+			contentType:      jsonContentType,
+			request:          `{"kind": "AdmissionReview", "apiVersion": "admission.k8s.io/v1beta1"}`,
+			expectedStatus:   http.StatusOK,
+			expectedResponse: `{"response":{"uid":"","allowed":false,"status":{"metadata":{},"status":"Failure","message":"malformed admission review (request is nil)","reason":"BadRequest","code":400}}}`,
+		},
+		{
+			description:      "GET request",
+			method:           http.MethodGet,
+			expectedStatus:   http.StatusMethodNotAllowed,
+			expectedResponse: "Method Not Allowed\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.method, "/mutate", bytes.NewBufferString(testCase.request))
+			req.Header.Set("Content-Type", testCase.contentType)
+			rec := httptest.NewRecorder()
+			webhookHandler(rec, req)
+
+			if rec.Code != testCase.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", testCase.expectedStatus, rec.Code)
+			}
+			if rec.Body.String() != testCase.expectedResponse {
+				t.Errorf("Expected response body %s, got %s", testCase.expectedResponse, rec.Body.String())
+			}
+		})
+	}
+}
@@ -1,50 +1,87 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/api/admission/v1beta1"
 	v1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 const (
 	jsonContentType = "application/json"
+
+	// Serving certificate sources.
+	certModeFile       = "file"
+	certModeSelfSigned = "self-signed"
+
+	// defaultMaxRequestBytes allows for an object and its oldObject, each up to etcd's 1.5MiB limit.
+	defaultMaxRequestBytes = 3 << 20
 )
 
 var (
+	// supportedKinds lists the apps/v1 workload kinds the webhook adds tolerations to.
+	supportedKinds = []supportedKind{
+		{kind: "Deployment", resource: "deployments", newObject: func() runtime.Object { return &v1.Deployment{} }},
+		{kind: "DaemonSet", resource: "daemonsets", newObject: func() runtime.Object { return &v1.DaemonSet{} }},
+	}
+
 	deserializer = serializer.NewCodecFactory(runtime.NewScheme()).UniversalDeserializer()
-	toleration   = corev1.Toleration{
+
+	// toleration is added to supported workloads that lack it, its key names the rule in metrics.
+	toleration = corev1.Toleration{
 		Key:      "SimulateNodeFailure",
 		Operator: corev1.TolerationOpExists,
 		Effect:   corev1.TaintEffectNoExecute,
 	}
 )
 
-// parseFlags parses the CLI params and returns a ServerParameters struct.
-func parseFlags() serverParameters {
-	var parameters serverParameters
+// podNamespace returns the namespace the webhook runs in, as exposed by the POD_NAMESPACE downward API variable.
+func podNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	return "toleration-webhook"
+}
 
-	// Define and parse CLI params using the "flag" package.
-	flag.IntVar(&parameters.httpsPort, "httpsPort", 443, " Https server port (webhook endpoint).")
-	flag.StringVar(&parameters.certFile, "tlsCertFile", "/etc/webhook/certs/tls.crt", "File containing the x509 Certificate for HTTPS.")
-	flag.StringVar(&parameters.keyFile, "tlsKeyFile", "/etc/webhook/certs/tls.key", "File containing the x509 private key to --tlsCertFile.")
-	flag.IntVar(&parameters.httpPort, "httpPort", 9090, " Http server port (monitoring endpoint).")
-	flag.Parse()
+// httpsTimeouts returns the read, write and idle timeouts for the https server.
+// Timeouts that were not set explicitly are derived from webhookTimeoutSeconds,
+// so the server stops working on requests the API server has already given up on.
+func httpsTimeouts(parameters serverParameters) (read, write, idle time.Duration) {
+	webhookTimeout := time.Duration(parameters.webhookTimeoutSeconds) * time.Second
 
-	return parameters
+	read, write, idle = parameters.readTimeout, parameters.writeTimeout, parameters.idleTimeout
+	if read == 0 {
+		read = webhookTimeout
+	}
+	if write == 0 {
+		write = webhookTimeout
+	}
+	if idle == 0 {
+		idle = 3 * webhookTimeout
+	}
+	return read, write, idle
 }
 
-// validateRequest checks requests are POST with Content-Type: application/json
+// validateRequest checks requests are POST with Content-Type: application/json.
+// Requests with the wrong content type are answered with a denied AdmissionReview.
 func validateRequest(w http.ResponseWriter, r *http.Request) bool {
 	if r.Method != http.MethodPost {
 		w.Header().Set("Allow", http.MethodPost)
@@ -52,8 +89,11 @@ func validateRequest(w http.ResponseWriter, r *http.Request) bool {
 		return false
 	}
 
-	if contentType := r.Header.Get("Content-Type"); contentType != jsonContentType {
-		http.Error(w, fmt.Sprintf("Invalid content type %s", contentType), http.StatusBadRequest)
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != jsonContentType {
+		err := fmt.Errorf("invalid content type %q", contentType)
+		slog.Warn("Admission request rejected", "decision", decisionDenied, "error", err)
+		sendResponse(w, errorResponse(&admissionError{code: http.StatusUnsupportedMediaType, err: err}))
 		return false
 	}
 
@@ -61,56 +101,69 @@ func validateRequest(w http.ResponseWriter, r *http.Request) bool {
 }
 
 // parseRequest parses the AdmissionReview request.
+// Failures are returned as an *admissionError carrying the request UID when it can be recovered from the body.
 func parseRequest(w http.ResponseWriter, r *http.Request) (*v1beta1.AdmissionReview, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read request body: %s", err.Error())
+		code := int32(http.StatusBadRequest)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		return nil, &admissionError{code: code, err: fmt.Errorf("failed to read request body: %w", err)}
 	}
 
 	var admissionReviewReq v1beta1.AdmissionReview
 	if _, _, err := deserializer.Decode(body, nil, &admissionReviewReq); err != nil {
-		return nil, fmt.Errorf("could not deserialize request: %s", err.Error())
+		return nil, &admissionError{
+			uid:  admissionUIDFromBody(body),
+			code: http.StatusBadRequest,
+			err:  fmt.Errorf("could not deserialize request: %s", err.Error()),
+		}
 	} else if admissionReviewReq.Request == nil {
-		return nil, fmt.Errorf("malformed admission review (request is nil)")
+		return nil, &admissionError{code: http.StatusBadRequest, err: fmt.Errorf("malformed admission review (request is nil)")}
 	}
 
-	// DEBUG Print string(body) when you want to see the AdmissionReview in the logs
-	// log.Printf("Admission Request Body: \n %v", string(body))
-
 	return &admissionReviewReq, nil
 }
 
-// buildResponse builds the AdmissionReview response.
-func buildResponse(w http.ResponseWriter, req v1beta1.AdmissionReview) (*v1beta1.AdmissionReview, error) {
-	var targetObject runtime.Object
-	var resourceType string
-
-	switch req.Request.Kind.Kind {
-	case "Deployment":
-		// Unmarshal the Deployment object from the AdmissionReview request into a Deployment struct.
-		targetObject = &v1.Deployment{}
-		resourceType = "Deployment"
-	case "DaemonSet":
-		// Unmarshal the DaemonSet object from the AdmissionReview request into a DaemonSet struct.
-		targetObject = &v1.DaemonSet{}
-		resourceType = "DaemonSet"
-	default:
-		return nil, fmt.Errorf("unsupported resource type: %s", req.Request.Kind.Kind)
+// admissionUIDFromBody makes a best effort to read the request UID from an AdmissionReview that failed to decode.
+func admissionUIDFromBody(body []byte) types.UID {
+	var partial struct {
+		Request struct {
+			UID types.UID `json:"uid"`
+		} `json:"request"`
 	}
+	_ = json.Unmarshal(body, &partial)
+	return partial.Request.UID
+}
 
-	err := json.Unmarshal(req.Request.Object.Raw, targetObject)
-	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal %s on admission request: %s", resourceType, err.Error())
+// errorResponse builds a denied AdmissionReview response whose status describes err.
+func errorResponse(err error) v1beta1.AdmissionReview {
+	var admissionErr *admissionError
+	if !errors.As(err, &admissionErr) {
+		admissionErr = &admissionError{code: http.StatusInternalServerError, err: err}
 	}
 
-	// Construct resource name in the format: namespace/name
-	resourceName := getResourceName(targetObject)
+	return v1beta1.AdmissionReview{
+		Response: &v1beta1.AdmissionResponse{
+			UID:     admissionErr.uid,
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: admissionErr.Error(),
+				Reason:  admissionErr.reason(),
+				Code:    admissionErr.code,
+			},
+		},
+	}
+}
 
-	log.Printf("New Admission Review Request is being processed: User: %v \t Operation: %v \t Pod: %v \n",
-		req.Request.UserInfo.Username,
-		req.Request.Operation,
-		resourceName,
-	)
+// buildResponse builds the AdmissionReview response adding the required toleration to supported workloads.
+// Policy evaluation and patch building are traced as child spans of ctx.
+func buildResponse(ctx context.Context, req v1beta1.AdmissionReview, required corev1.Toleration) (*v1beta1.AdmissionReview, error) {
+	var targetObject runtime.Object
+	var resourceType string
 
 	// Construct the AdmissionReview response.
 	admissionReviewResponse := v1beta1.AdmissionReview{
@@ -120,47 +173,96 @@ func buildResponse(w http.ResponseWriter, req v1beta1.AdmissionReview) (*v1beta1
 		},
 	}
 
+	supported, ok := lookupKind(req.Request.Kind.Kind)
+	if !ok {
+		// Unsupported kinds are let through untouched rather than failing the API request.
+		requestLogger(req.Request, req.Request.Namespace, req.Request.Name, decisionIgnored).
+			Info("Unsupported resource type, skipping")
+		RecordObject(string(req.Request.Operation), req.Request.Kind.Kind, req.Request.Namespace, req.Request.Name, "", decisionIgnored)
+		admissionReviewResponse.Response.AuditAnnotations = auditAnnotations("", decisionIgnored, nil)
+		return &admissionReviewResponse, nil
+	}
+	// Unmarshal the object from the AdmissionReview request into its typed struct.
+	targetObject = supported.newObject()
+	resourceType = supported.kind
+
+	err := json.Unmarshal(req.Request.Object.Raw, targetObject)
+	if err != nil {
+		err = fmt.Errorf("could not unmarshal %s on admission request: %s", resourceType, err.Error())
+		requestLogger(req.Request, req.Request.Namespace, req.Request.Name, decisionDenied).
+			Error("Admission request rejected", "error", err)
+		RecordObject(string(req.Request.Operation), resourceType, req.Request.Namespace, req.Request.Name, required.Key, decisionDenied)
+		return nil, &admissionError{uid: req.Request.UID, code: http.StatusBadRequest, err: err}
+	}
+
+	// Construct resource name in the format: namespace/name
+	resourceName := getResourceName(targetObject)
+	namespace, name := strings.Split(resourceName, "/")[0], strings.Split(resourceName, "/")[1]
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(attributeNamespace, namespace), attribute.String(attributeName, name))
+
 	//  Check if toleration is already set
-	if !tolerationExists(targetObject, toleration) {
-		log.Printf("Toleration does not exist in %s %s", resourceType, resourceName)
-		patchBytes, err := buildJsonPatch(targetObject, toleration)
+	_, evaluateSpan := tracer.Start(ctx, "policy.evaluate", trace.WithAttributes(attribute.String("policy.rule", required.Key)))
+	exists := tolerationExists(targetObject, required)
+	evaluateSpan.SetAttributes(attribute.Bool("policy.compliant", exists))
+	evaluateSpan.End()
+	if !exists {
+		_, patchSpan := tracer.Start(ctx, "patch.build")
+		patchBytes, err := buildJsonPatch(targetObject, required)
+		endSpan(patchSpan, err)
 		if err != nil {
-			return nil, fmt.Errorf("could not build JSON patch: %s", err.Error())
+			err = fmt.Errorf("could not build JSON patch: %s", err.Error())
+			requestLogger(req.Request, namespace, name, decisionDenied).Error("Admission request rejected", "error", err)
+			RecordObject(string(req.Request.Operation), resourceType, namespace, name, required.Key, decisionDenied)
+			return nil, &admissionError{uid: req.Request.UID, code: http.StatusInternalServerError, err: err}
 		}
-		// admissionReviewResponse.Response.AuditAnnotations = targetObject.ObjectMeta.Annotations // AuditAnnotations are added to the audit record when this admission response is added to the audit event.
+		// AuditAnnotations are added to the audit record when this admission response is added to the audit event.
+		admissionReviewResponse.Response.AuditAnnotations = auditAnnotations(required.Key, decisionMutated, []corev1.Toleration{required})
 		admissionReviewResponse.Response.Patch = patchBytes
 		patchMsg := fmt.Sprintf("%s %v was updated with toleration.", resourceType, resourceName)
 		stdoutMsg := fmt.Sprintf("%s %v does not have a toleration set.", resourceType, resourceName)
 		admissionReviewResponse.Response.Warnings = []string{stdoutMsg, patchMsg}
-		log.Println(patchMsg)
+		requestLogger(req.Request, namespace, name, decisionMutated).Info("Toleration added", "toleration", required.Key)
+		recordTolerationEvent(req.Request, targetObject, required.Key, []corev1.Toleration{required})
 		// Record the object in Prometheus
-		RecordObject(fmt.Sprintf("%v", req.Request.Operation), resourceType, strings.Split(resourceName, "/")[1], strings.Split(resourceName, "/")[0], "true")
+		RecordObject(string(req.Request.Operation), resourceType, namespace, name, required.Key, decisionMutated)
 	} else {
-		log.Printf("Toleration already exists in %s %s, skipping addition", resourceType, resourceName)
+		admissionReviewResponse.Response.AuditAnnotations = auditAnnotations(required.Key, decisionUnchanged, nil)
+		requestLogger(req.Request, namespace, name, decisionUnchanged).Info("Toleration already exists, skipping addition", "toleration", required.Key)
 		// Record the object in Prometheus
-		RecordObject(fmt.Sprintf("%v", req.Request.Operation), resourceType, strings.Split(resourceName, "/")[1], strings.Split(resourceName, "/")[0], "false")
+		RecordObject(string(req.Request.Operation), resourceType, namespace, name, required.Key, decisionUnchanged)
 	}
 
 	return &admissionReviewResponse, nil
 }
 
 // sendResponse writes the AdmissionReview response to the http response writer.
-func sendResponse(w http.ResponseWriter, admissionReviewResponse v1beta1.AdmissionReview) {
+// The returned error reports responses that could not be marshalled or written.
+func sendResponse(w http.ResponseWriter, admissionReviewResponse v1beta1.AdmissionReview) error {
 	// Marshal the AdmissionReview response to JSON.
 	bytes, err := json.Marshal(&admissionReviewResponse)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("could not marshal JSON Admission Response: %s", err.Error()), http.StatusInternalServerError)
-		return
+		err = fmt.Errorf("could not marshal JSON Admission Response: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
 	}
 
 	// Write the AdmissionReview response to the http response writer.
 	w.Header().Set("Content-Type", jsonContentType)
-	w.Write(bytes)
+	if _, err := w.Write(bytes); err != nil {
+		return fmt.Errorf("could not write JSON Admission Response: %s", err.Error())
+	}
+	return nil
 }
 
 // buildJsonPatch builds a JSON patch to add a toleration and annotation to a Pod.
 func buildJsonPatch(targetObject runtime.Object, toleration corev1.Toleration) ([]byte, error) {
+	// Objects without annotations need the annotations map added rather than replaced.
+	annotationsOp := "replace"
 	annotations := getAnnotations(targetObject)
+	if annotations == nil {
+		annotationsOp = "add"
+		annotations = map[string]string{}
+	}
 	annotations["updated_by"] = "tolerationWebhook"
 
 	var tolerations []corev1.Toleration
@@ -182,7 +284,7 @@ func buildJsonPatch(targetObject runtime.Object, toleration corev1.Toleration) (
 			Value: tolerations,
 		},
 		{
-			Op:    "replace",
+			Op:    annotationsOp,
 			Path:  "/metadata/annotations",
 			Value: annotations,
 		},
@@ -197,11 +299,21 @@ func buildJsonPatch(targetObject runtime.Object, toleration corev1.Toleration) (
 	return patchBytes, nil
 }
 
+// lookupKind returns the supported kind matching kind.
+func lookupKind(kind string) (supportedKind, bool) {
+	for _, supported := range supportedKinds {
+		if supported.kind == kind {
+			return supported, true
+		}
+	}
+	return supportedKind{}, false
+}
+
 // getAnnotations extracts and returns the annotations from the targetObject
 func getAnnotations(obj runtime.Object) map[string]string {
 	meta, err := meta.Accessor(obj)
 	if err != nil {
-		log.Printf("Error getting annotations: %v", err)
+		slog.Error("Error getting annotations", "error", err)
 		return nil
 	}
 	return meta.GetAnnotations()
@@ -215,7 +327,7 @@ func tolerationExists(targetObject runtime.Object, toleration corev1.Toleration)
 	case *v1.DaemonSet:
 		return tolerationExistsInSlice(obj.Spec.Template.Spec.Tolerations, toleration)
 	default:
-		log.Printf("Unsupported resource type for toleration check: %T", targetObject)
+		slog.Warn("Unsupported resource type for toleration check", "type", fmt.Sprintf("%T", targetObject))
 		return false
 	}
 }
@@ -237,7 +349,7 @@ func tolerationExistsInSlice(existingTolerations []corev1.Toleration, toleration
 func getResourceName(obj runtime.Object) string {
 	meta, err := meta.Accessor(obj)
 	if err != nil {
-		log.Printf("Error getting resource name: %v", err)
+		slog.Error("Error getting resource name", "error", err)
 		return ""
 	}
 	return meta.GetNamespace() + "/" + meta.GetName()
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "k8s.io/api/apps/v1"
+)
+
+// TestBuildJsonPatchWithoutAnnotations tests that objects without annotations get the annotations map added.
+func TestBuildJsonPatchWithoutAnnotations(t *testing.T) {
+	deployment := &v1.Deployment{}
+	deployment.Name, deployment.Namespace = "test-dep", "foo"
+
+	patchBytes, err := buildJsonPatch(deployment, toleration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var patch []patchOperation
+	if err := json.Unmarshal(patchBytes, &patch); err != nil {
+		t.Fatal(err)
+	}
+	if len(patch) != 2 || patch[1].Op != "add" || patch[1].Path != "/metadata/annotations" {
+		t.Errorf("Expected annotations to be added, got %s", string(patchBytes))
+	}
+}
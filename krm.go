@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	resourceListAPIVersion = "config.kubernetes.io/v1"
+	resourceListKind       = "ResourceList"
+)
+
+// resourceList is the KRM function input and output, see
+// https://github.com/kubernetes-sigs/kustomize/blob/master/cmd/config/docs/api-conventions/functions-spec.md
+type resourceList struct {
+	APIVersion     string            `json:"apiVersion"`
+	Kind           string            `json:"kind"`
+	Items          []json.RawMessage `json:"items"`
+	FunctionConfig json.RawMessage   `json:"functionConfig,omitempty"`
+	Results        []krmResult       `json:"results,omitempty"`
+}
+
+// krmResult reports the action taken on an item of a resourceList.
+type krmResult struct {
+	Message     string          `json:"message"`
+	Severity    string          `json:"severity"`
+	ResourceRef *krmResourceRef `json:"resourceRef,omitempty"`
+}
+
+// krmResourceRef identifies the item a krmResult is about.
+type krmResourceRef struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// policyToleration returns the toleration required by functionConfig, the webhook's own when there is none.
+func policyToleration(functionConfig json.RawMessage) (corev1.Toleration, error) {
+	if len(functionConfig) == 0 || string(functionConfig) == "null" {
+		return toleration, nil
+	}
+	required, err := parseTolerationPolicy(functionConfig)
+	if err != nil {
+		return corev1.Toleration{}, fmt.Errorf("invalid functionConfig: %s", err.Error())
+	}
+	return required, nil
+}
+
+// runKRM implements the krm subcommand: it runs as a KRM function for kustomize and kpt, reading a ResourceList
+// from stdin, adding the toleration of its functionConfig to every supported workload in its items and writing it
+// back to stdout with a result per workload.
+func runKRM(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		fmt.Fprintln(stderr, "Usage: webhook krm < resource-list.yaml")
+		return 2
+	}
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	var list resourceList
+	if err := yaml.Unmarshal(input, &list); err != nil {
+		fmt.Fprintf(stderr, "could not read ResourceList: %s\n", err.Error())
+		return 1
+	}
+	if list.Kind != resourceListKind {
+		fmt.Fprintf(stderr, "expected a %s, got kind %q\n", resourceListKind, list.Kind)
+		return 1
+	}
+
+	code := 0
+	required, err := policyToleration(list.FunctionConfig)
+	if err != nil {
+		list.Results = append(list.Results, krmResult{Message: err.Error(), Severity: "error"})
+		code = 1
+	} else {
+		for i, item := range list.Items {
+			result, mutated := mutateItem(item, required)
+			list.Items[i] = mutated
+			if result != nil {
+				list.Results = append(list.Results, *result)
+				if result.Severity == "error" {
+					code = 1
+				}
+			}
+		}
+	}
+
+	if list.APIVersion == "" {
+		list.APIVersion = resourceListAPIVersion
+	}
+	output, err := json.Marshal(list)
+	if err == nil {
+		output, err = yaml.JSONToYAML(output)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	stdout.Write(output)
+	return code
+}
+
+// mutateItem applies the policy requiring the given toleration to a resourceList item, returning its result,
+// nil for unsupported kinds, and the item to write back.
+func mutateItem(item json.RawMessage, required corev1.Toleration) (*krmResult, json.RawMessage) {
+	var object metav1.PartialObjectMetadata
+	if err := json.Unmarshal(item, &object); err != nil {
+		return &krmResult{Message: fmt.Sprintf("could not decode item: %s", err.Error()), Severity: "error"}, item
+	}
+	ref := &krmResourceRef{APIVersion: object.APIVersion, Kind: object.Kind, Name: object.Name, Namespace: object.Namespace}
+
+	m, err := mutateManifest(item, required)
+	if err != nil {
+		return &krmResult{Message: err.Error(), Severity: "error", ResourceRef: ref}, item
+	}
+	switch m.Action {
+	case decisionMutated:
+		return &krmResult{Message: fmt.Sprintf("%s: added toleration %s", m.Action, required.Key), Severity: "info", ResourceRef: ref}, m.Mutated
+	case decisionUnchanged:
+		return &krmResult{Message: fmt.Sprintf("%s: toleration %s already set", m.Action, required.Key), Severity: "info", ResourceRef: ref}, item
+	default:
+		return nil, item
+	}
+}
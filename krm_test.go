@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// TestRunKRM tests the KRM function applies the functionConfig policy to supported items and reports per-item results.
+func TestRunKRM(t *testing.T) {
+	useTestMetrics(t)
+	input := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+functionConfig:
+  apiVersion: toleration-webhook.andreistefanciprian.github.io/v1alpha1
+  kind: TolerationPolicy
+  metadata:
+    name: policy
+  spec:
+    toleration:
+      key: dedicated
+      operator: Equal
+      value: batch
+      effect: NoSchedule
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: test-dep
+    namespace: foo
+  spec:
+    template:
+      spec: {}
+- apiVersion: apps/v1
+  kind: DaemonSet
+  metadata:
+    name: test-ds
+    namespace: foo
+  spec:
+    template:
+      spec:
+        tolerations:
+        - key: dedicated
+          operator: Equal
+          value: batch
+          effect: NoSchedule
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: test-cm
+`
+	var stdout, stderr bytes.Buffer
+	if code := runKRM(nil, strings.NewReader(input), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if toleration.Key != "SimulateNodeFailure" {
+		t.Errorf("Expected the webhook toleration to be left alone, got %s", toleration.Key)
+	}
+
+	var output struct {
+		resourceList
+		Items []struct {
+			Kind string `json:"kind"`
+			Spec struct {
+				Template struct {
+					Spec corev1.PodSpec `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	if err := yaml.Unmarshal(stdout.Bytes(), &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.Kind != resourceListKind || len(output.Items) != 3 {
+		t.Fatalf("Expected a ResourceList with 3 items, got %s", stdout.String())
+	}
+	expected := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "batch", Effect: corev1.TaintEffectNoSchedule}
+	if tolerations := output.Items[0].Spec.Template.Spec.Tolerations; len(tolerations) != 1 || tolerations[0] != expected {
+		t.Errorf("Expected the policy toleration on the Deployment, got %v", tolerations)
+	}
+	if tolerations := output.Items[1].Spec.Template.Spec.Tolerations; len(tolerations) != 1 {
+		t.Errorf("Expected the DaemonSet to be unchanged, got %v", tolerations)
+	}
+
+	results := output.resourceList.Results
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", results)
+	}
+	if results[0].Message != "mutated: added toleration dedicated" || results[0].ResourceRef.Name != "test-dep" || results[0].Severity != "info" {
+		t.Errorf("Unexpected Deployment result %+v", results[0])
+	}
+	if results[1].Message != "unchanged: toleration dedicated already set" || results[1].ResourceRef.Kind != "DaemonSet" {
+		t.Errorf("Unexpected DaemonSet result %+v", results[1])
+	}
+}
+
+// TestPolicyToleration tests the functionConfig forms accepted by the KRM function.
+func TestPolicyToleration(t *testing.T) {
+	testCases := []struct {
+		description    string
+		functionConfig string
+		expected       corev1.Toleration
+		expectedError  bool
+	}{
+		{"none", "", toleration, false},
+		{"ConfigMap", `{"kind":"ConfigMap","data":{"key":"dedicated","effect":"NoSchedule"}}`, corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}, false},
+		{"missing key", `{"kind":"TolerationPolicy","spec":{"toleration":{"effect":"NoSchedule"}}}`, corev1.Toleration{}, true},
+		{"unknown kind", `{"kind":"Secret"}`, corev1.Toleration{}, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			required, err := policyToleration([]byte(testCase.functionConfig))
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("Expected error %v, got %v", testCase.expectedError, err)
+			}
+			if required != testCase.expected {
+				t.Errorf("Expected %+v, got %+v", testCase.expected, required)
+			}
+		})
+	}
+}
+
+// TestRunKRMInvalidFunctionConfig tests an invalid functionConfig is reported as an error result.
+func TestRunKRMInvalidFunctionConfig(t *testing.T) {
+	input := `{"apiVersion":"config.kubernetes.io/v1","kind":"ResourceList","items":[],"functionConfig":{"kind":"Secret"}}`
+	var stdout, stderr bytes.Buffer
+	if code := runKRM(nil, strings.NewReader(input), &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "severity: error") {
+		t.Errorf("Expected an error result, got %s", stdout.String())
+	}
+}
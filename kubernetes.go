@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newKubernetesClient returns a clientset for the cluster the webhook runs in,
+// or for the cluster of the given kubeconfig file when it is set.
+func newKubernetesClient(kubeconfig string) (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubernetes client config: %s", err.Error())
+	}
+	config.UserAgent = "k8s-toleration-webhook"
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create kubernetes client: %s", err.Error())
+	}
+	return client, nil
+}
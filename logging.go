@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"k8s.io/api/admission/v1beta1"
+)
+
+// newLogger returns a structured logger writing to w in the given format ("json" or "text")
+// and discarding records below the given level ("debug", "info", "warn" or "error").
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %s", level, err.Error())
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: must be json or text", format)
+	}
+}
+
+// requestLogger returns a logger carrying the attributes of an admission request and the decision taken for it.
+func requestLogger(req *v1beta1.AdmissionRequest, namespace, name, decision string) *slog.Logger {
+	return slog.With(
+		"uid", req.UID,
+		"user", req.UserInfo.Username,
+		"operation", req.Operation,
+		"kind", req.Kind.Kind,
+		"namespace", namespace,
+		"name", name,
+		"decision", decision,
+	)
+}
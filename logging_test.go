@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRequestLogAttributes tests that every log line of an admission request carries the request attributes.
+func TestRequestLogAttributes(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := newLogger(&logs, "json", "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultLogger := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(defaultLogger)
+
+	req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "")))
+	req.Header.Set("Content-Type", jsonContentType)
+	webhookHandler(httptest.NewRecorder(), req)
+
+	expectedAttributes := map[string]string{
+		"uid":       "f0b23c24-35f6-42a3-99e3-aa4ccab85f91",
+		"user":      "someuser@gmail.com",
+		"operation": "CREATE",
+		"kind":      "Deployment",
+		"namespace": "foo",
+		"name":      "test-dep",
+		"decision":  decisionMutated,
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(&logs)
+	for scanner.Scan() {
+		lines++
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Expected JSON log line, got %s", scanner.Text())
+		}
+		for key, expected := range expectedAttributes {
+			if record[key] != expected {
+				t.Errorf("Expected %s=%s in log line %s", key, expected, scanner.Text())
+			}
+		}
+	}
+	if lines == 0 {
+		t.Error("Expected the admission request to be logged")
+	}
+}
+
+// TestNewLoggerInvalidSettings tests that unknown log formats and levels are rejected.
+func TestNewLoggerInvalidSettings(t *testing.T) {
+	if _, err := newLogger(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("Expected an error for log format xml")
+	}
+	if _, err := newLogger(&bytes.Buffer{}, "text", "verbose"); err == nil {
+		t.Error("Expected an error for log level verbose")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// seriesLRU tracks metric series by label values and evicts the least recently used ones past its capacity.
+type seriesLRU struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List               // label values, most recently used first
+	entries  map[string]*list.Element // order elements keyed by joined label values
+	evict    func(labels []string)    // called with the label values of evicted series
+}
+
+// newSeriesLRU returns a seriesLRU holding up to capacity series.
+func newSeriesLRU(capacity int, evict func(labels []string)) *seriesLRU {
+	return &seriesLRU{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+		evict:    evict,
+	}
+}
+
+// touch marks the series as recently used and records it with record, evicting the least recently used series
+// when over capacity. record is called while holding the lock, so a concurrent eviction cannot delete the series
+// between it being marked and recorded and leave it untracked.
+func (l *seriesLRU) touch(labels []string, record func()) {
+	key := strings.Join(labels, "\x00")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record()
+	if element, ok := l.entries[key]; ok {
+		l.order.MoveToFront(element)
+		return
+	}
+	l.entries[key] = l.order.PushFront(labels)
+
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		evicted := oldest.Value.([]string)
+		delete(l.entries, strings.Join(evicted, "\x00"))
+		l.evict(evicted)
+	}
+}
@@ -1,45 +1,254 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 )
 
 func main() {
+	// Subcommands run the webhook logic offline and exit, logging warnings and errors only.
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+			os.Exit(run(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+
 	// Parse CLI params
 	parameters := parseFlags()
 
+	// Set up structured logging, the standard library logger is routed through it as well.
+	logger, err := newLogger(os.Stderr, parameters.logFormat, parameters.logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	// Stop serving on SIGINT and SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Export admission spans over OTLP when an endpoint is configured.
+	shutdownTracing, err := setupTracing(ctx, parameters.otlpEndpoint, parameters.traceSampleRatio)
+	if err != nil {
+		slog.Error("Could not set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	// Create a new https server
 	httpsMux := mux.NewRouter()
 
 	// webhookHandler handler
-	httpsMux.HandleFunc("/mutate", webhookHandler)
+	httpsMux.HandleFunc(webhookPath, webhookHandler)
+	httpsMux.Use(recoverPanics(parameters.denyOnPanic), limitInFlight(parameters.maxInFlight), limitRequestBody(parameters.maxRequestBytes))
+	if parameters.debugBodies {
+		httpsMux.Use(newBodyLogger(parameters.debugRedactPaths, parameters.debugMaxBodyBytes, parameters.debugSampleRate).middleware())
+	}
 
 	httpsAddr := ":" + strconv.Itoa(parameters.httpsPort)
-	httpsServer := http.Server{
-		Addr:    httpsAddr,
-		Handler: httpsMux,
+	readTimeout, writeTimeout, idleTimeout := httpsTimeouts(parameters)
+	httpsServer := &http.Server{
+		Addr:              httpsAddr,
+		Handler:           httpsMux,
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
 	}
 
-	// Start the https server
-	go func() {
-		log.Printf("Starting https Server on port %s", httpsAddr)
-		err := httpsServer.ListenAndServeTLS(parameters.certFile, parameters.keyFile)
+	// The kubernetes client is only needed by the modes that manage cluster resources.
+	var client kubernetes.Interface
+	if parameters.certMode == certModeSelfSigned || parameters.registerWebhook || parameters.recordEvents || parameters.coverageMetrics ||
+		parameters.driftCheckInterval > 0 || parameters.backfillInterval > 0 {
+		client, err = newKubernetesClient(parameters.kubeconfig)
+		if err != nil {
+			slog.Error("Could not create kubernetes client", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Record Events on mutated workloads.
+	stopEvents := func() {}
+	if parameters.recordEvents {
+		eventRecorder, stopEvents = newEventRecorder(client, float32(parameters.eventQPS), parameters.eventBurst)
+	}
+
+	// Create or update the MutatingWebhookConfiguration. In self-signed mode the caBundle is injected below.
+	if parameters.registerWebhook {
+		caBundle, err := readCABundle(parameters.caFile)
+		if err != nil {
+			slog.Error("Could not register webhook", "error", err)
+			os.Exit(1)
+		}
+		configuration, err := buildWebhookConfiguration(parameters, caBundle)
+		if err != nil {
+			slog.Error("Could not register webhook", "error", err)
+			os.Exit(2)
+		}
+		if err := registerWebhookConfiguration(ctx, client, configuration); err != nil {
+			slog.Error("Could not register webhook", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load the serving certificate from files, or bootstrap a self-signed one and inject its CA.
+	certFile, keyFile := parameters.certFile, parameters.keyFile
+	servedCertificate := func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(parameters.certFile, parameters.keyFile)
+		return &cert, err
+	}
+	if parameters.certMode == certModeSelfSigned {
+		certs, err := newCertReloader(ctx, client, parameters)
+		if err != nil {
+			slog.Error("Could not bootstrap self-signed certificate", "error", err)
+			os.Exit(1)
+		}
+		go certs.run(ctx, certCheckInterval)
+		httpsServer.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+		certFile, keyFile = "", ""
+		servedCertificate = certs.current
+	}
+
+	// Write admission decisions to the decision log.
+	var decisions *decisionLog
+	if parameters.decisionLogFile != "" {
+		decisions, err = newDecisionLog(parameters.decisionLogFile, parameters.decisionLogMaxBytes, parameters.decisionLogMaxAge, parameters.decisionLogMaxBackups, parameters.decisionLogQueue)
+		if err != nil {
+			slog.Error("Could not open decision log", "error", err)
+			os.Exit(1)
+		}
+		decisionSinks = append(decisionSinks, decisions)
+	}
+
+	// Send admission decisions as CloudEvents.
+	var cloudEvents *cloudEventsSink
+	if parameters.cloudEventsURL != "" {
+		cloudEvents = newCloudEventsSink(parameters.cloudEventsURL, parameters.cloudEventsSource, parameters.cloudEventsActions,
+			parameters.cloudEventsSigningKey, parameters.cloudEventsQueue, parameters.cloudEventsAttempts, parameters.cloudEventsBackoff)
+		decisionSinks = append(decisionSinks, cloudEvents)
+	}
+
+	// Set up the metrics and the monitoring routes before serving admission requests.
+	metrics = newWebhookMetrics(parameters.metricsNamespaceLabel, parameters.metricsObjectLimit)
+	registry := newMetricsRegistry(metrics)
+	if parameters.coverageMetrics {
+		factory := informers.NewSharedInformerFactory(client, 0)
+		coverage, err := newCoverageCollector(factory, parameters.namespaceSelector, parameters.objectSelector)
+		if err != nil {
+			slog.Error("Could not set up coverage metrics", "error", err)
+			os.Exit(2)
+		}
+		registry.MustRegister(coverage)
+		factory.Start(ctx.Done())
+		go func() {
+			if coverage.waitForSync(ctx) {
+				slog.Info("Coverage metrics ready")
+			}
+		}()
+	}
+	monitoringRouter := newMonitoringRouter(parameters, registry)
+	var drift *driftDetector
+	if parameters.driftCheckInterval > 0 {
+		drift = newDriftDetector(client, parameters, servedCertificate)
+		go drift.run(ctx, parameters.driftCheckInterval)
+	}
+	monitoringRouter.Handle("/readyz", readyzHandler(drift))
+	if parameters.backfillInterval > 0 {
+		backfill, err := newBackfillController(client, parameters)
 		if err != nil {
-			log.Fatal(err)
+			slog.Error("Could not set up backfill", "error", err)
+			os.Exit(2)
+		}
+		run := func(ctx context.Context) { backfill.run(ctx, parameters.backfillInterval) }
+		if parameters.backfillLeaseName == "" {
+			go run(ctx)
+		} else {
+			go func() {
+				if err := runLeaderElected(ctx, client, podNamespace(), parameters.backfillLeaseName, run); err != nil {
+					slog.Error("Could not run backfill", "error", err)
+				}
+			}()
 		}
+	}
+	if parameters.recentDecisions > 0 {
+		recent := newDecisionRing(parameters.recentDecisions)
+		decisionSinks = append(decisionSinks, recent)
+		monitoringRouter.Handle("/debug/decisions", recent)
+	}
+
+	serverErrors := make(chan error, 2)
+
+	// Start the https server
+	go func() {
+		slog.Info("Starting https Server", "addr", httpsAddr)
+		serverErrors <- fmt.Errorf("https Server failed: %w", httpsServer.ListenAndServeTLS(certFile, keyFile))
 	}()
 
 	// Start the http server
 	httpAddr := ":" + strconv.Itoa(parameters.httpPort)
-	http.Handle("/metrics", promhttp.Handler())
-	log.Printf("Starting http Server on port %s", httpAddr)
-	err := http.ListenAndServe(httpAddr, nil)
-	if err != nil {
-		log.Fatal(err)
+	httpServer := &http.Server{
+		Addr:    httpAddr,
+		Handler: monitoringRouter,
+	}
+	go func() {
+		slog.Info("Starting http Server", "addr", httpAddr)
+		serverErrors <- fmt.Errorf("http Server failed: %w", httpServer.ListenAndServe())
+	}()
+
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	case err := <-serverErrors:
+		slog.Error("Shutting down", "error", err)
+		exitCode = 1
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Duration(parameters.webhookTimeoutSeconds)*time.Second)
+
+	if parameters.registerWebhook && parameters.unregisterOnShutdown {
+		if err := unregisterWebhookConfiguration(shutdownCtx, client, parameters.webhookConfigName); err != nil {
+			slog.Error("Could not unregister webhook", "error", err)
+			exitCode = 1
+		}
+	}
+	for _, server := range []*http.Server{httpsServer, httpServer} {
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Could not shut down server", "addr", server.Addr, "error", err)
+			exitCode = 1
+		}
+	}
+	stopEvents()
+	if cloudEvents != nil {
+		if err := cloudEvents.Close(shutdownCtx); err != nil {
+			slog.Error("Could not close CloudEvents sink", "error", err)
+			exitCode = 1
+		}
+	}
+	if decisions != nil {
+		if err := decisions.Close(); err != nil {
+			slog.Error("Could not close decision log", "error", err)
+			exitCode = 1
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Could not flush traces", "error", err)
+		exitCode = 1
 	}
+	cancel()
+	os.Exit(exitCode)
 }
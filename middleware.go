@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// admissionUIDKey is the context key under which recoverPanics expects the admission UID.
+type admissionUIDKey struct{}
+
+// setAdmissionUID records the UID of the admission request being handled,
+// so recoverPanics can answer the API server with a matching response.
+func setAdmissionUID(ctx context.Context, uid types.UID) {
+	if admissionUID, ok := ctx.Value(admissionUIDKey{}).(*types.UID); ok {
+		*admissionUID = uid
+	}
+}
+
+// recoverPanics recovers panics raised while handling a request, logs the stack with the
+// admission UID and answers with a well-formed AdmissionReview instead of dropping the connection.
+// The request is allowed without a patch, or denied when denyOnPanic is set.
+func recoverPanics(denyOnPanic bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			admissionUID := new(types.UID)
+			r = r.WithContext(context.WithValue(r.Context(), admissionUIDKey{}, admissionUID))
+
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				decision := decisionUnchanged
+				if denyOnPanic {
+					decision = decisionDenied
+				}
+				slog.Error("Recovered from panic while handling admission request",
+					"uid", *admissionUID,
+					"decision", decision,
+					"panic", fmt.Sprint(recovered),
+					"stack", string(debug.Stack()),
+				)
+				RecordPanic()
+				sendResponse(w, panicResponse(*admissionUID, denyOnPanic))
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// panicResponse builds the AdmissionReview response returned after recovering from a panic.
+func panicResponse(uid types.UID, denyOnPanic bool) v1beta1.AdmissionReview {
+	if denyOnPanic {
+		return errorResponse(&admissionError{
+			uid:  uid,
+			code: http.StatusInternalServerError,
+			err:  errors.New("toleration webhook failed to process the request"),
+		})
+	}
+	return v1beta1.AdmissionReview{
+		Response: &v1beta1.AdmissionResponse{
+			UID:     uid,
+			Allowed: true,
+		},
+	}
+}
+
+// limitRequestBody rejects requests whose body is larger than maxBytes.
+// Requests announcing a larger Content-Length are rejected before the body is read,
+// chunked requests fail while parseRequest reads past the limit.
+func limitRequestBody(maxBytes int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				sendResponse(w, errorResponse(&admissionError{
+					code: http.StatusRequestEntityTooLarge,
+					err:  fmt.Errorf("request body of %d bytes exceeds the %d bytes limit", r.ContentLength, maxBytes),
+				}))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitInFlight caps the number of requests served concurrently.
+// Requests over the cap are rejected straight away with 429 Too Many Requests
+// instead of queueing, so one misbehaving client can't starve the API server's calls.
+// The rejection is deliberately a plain HTTP error: the body is never read, and the
+// API server applies the webhook's failurePolicy to it.
+func limitInFlight(maxInFlight int) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if maxInFlight <= 0 {
+			return next
+		}
+
+		slots := make(chan struct{}, maxInFlight)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			}
+		})
+	}
+}
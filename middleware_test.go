@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestLimitRequestBody tests that oversized AdmissionReview requests are rejected.
+func TestLimitRequestBody(t *testing.T) {
+	request := makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "")
+
+	testCases := []struct {
+		description    string
+		maxBytes       int64
+		chunked        bool
+		expectedAllow  bool
+		expectedReason metav1.StatusReason
+	}{
+		{
+			description:   "request within limit",
+			maxBytes:      int64(len(request)),
+			expectedAllow: true,
+		},
+		{
+			description:    "Content-Length over limit",
+			maxBytes:       int64(len(request)) - 1,
+			expectedReason: metav1.StatusReasonRequestEntityTooLarge,
+		},
+		{
+			description:    "chunked body over limit",
+			maxBytes:       int64(len(request)) - 1,
+			chunked:        true,
+			expectedReason: metav1.StatusReasonRequestEntityTooLarge,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			router := mux.NewRouter()
+			router.HandleFunc("/mutate", webhookHandler)
+			router.Use(limitRequestBody(testCase.maxBytes))
+
+			req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(request))
+			req.Header.Set("Content-Type", jsonContentType)
+			if testCase.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+			}
+			var admissionReviewResponse v1beta1.AdmissionReview
+			if err := json.Unmarshal(rec.Body.Bytes(), &admissionReviewResponse); err != nil {
+				t.Fatal(err)
+			}
+			if allowed := admissionReviewResponse.Response.Allowed; allowed != testCase.expectedAllow {
+				t.Errorf("Expected allowed %t, got %t", testCase.expectedAllow, allowed)
+			}
+			if result := admissionReviewResponse.Response.Result; !testCase.expectedAllow && (result == nil || result.Reason != testCase.expectedReason) {
+				t.Errorf("Expected status reason %s, got %+v", testCase.expectedReason, result)
+			}
+		})
+	}
+}
+
+// TestLimitInFlight tests that requests over the concurrency cap are rejected without waiting.
+func TestLimitInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	handler := limitInFlight(1)(blocking)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/mutate", nil))
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mutate", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header to be set")
+	}
+
+	close(release)
+	<-done
+}
+
+// TestHttpsTimeouts tests that unset server timeouts are derived from webhookTimeoutSeconds.
+func TestHttpsTimeouts(t *testing.T) {
+	read, write, idle := httpsTimeouts(serverParameters{webhookTimeoutSeconds: 10, writeTimeout: 5 * time.Second})
+	if read != 10*time.Second || write != 5*time.Second || idle != 30*time.Second {
+		t.Errorf("Expected timeouts 10s/5s/30s, got %s/%s/%s", read, write, idle)
+	}
+}
+
+// TestRecoverPanics tests that a panicking handler still answers with a well-formed AdmissionReview.
+func TestRecoverPanics(t *testing.T) {
+	testCases := []struct {
+		description      string
+		denyOnPanic      bool
+		expectedResponse string
+	}{
+		{
+			description:      "fail open",
+			denyOnPanic:      false,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":true}}`,
+		},
+		{
+			description:      "fail closed",
+			denyOnPanic:      true,
+			expectedResponse: `{"response":{"uid":"f0b23c24-35f6-42a3-99e3-aa4ccab85f91","allowed":false,"status":{"metadata":{},"status":"Failure","message":"toleration webhook failed to process the request","reason":"InternalError","code":500}}}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				setAdmissionUID(r.Context(), "f0b23c24-35f6-42a3-99e3-aa4ccab85f91")
+				panic("boom")
+			})
+			handler := recoverPanics(testCase.denyOnPanic)(panicking)
+
+			useTestMetrics(t)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mutate", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+			}
+			if rec.Body.String() != testCase.expectedResponse {
+				t.Errorf("Expected response body %s, got %s", testCase.expectedResponse, rec.Body.String())
+			}
+			if panics := testutil.ToFloat64(metrics.panicCounter); panics != 1 {
+				t.Errorf("Expected 1 recorded panic, got %v", panics)
+			}
+		})
+	}
+}
@@ -1,24 +1,264 @@
 package main
 
 import (
+	"expvar"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/api/admission/v1beta1"
+)
+
+// Stages of webhookHandler that failures are counted by.
+const (
+	stageValidate = "validate"
+	stageParse    = "parse"
+	stageBuild    = "build"
+	stageSend     = "send"
+)
+
+// Outcomes of requests that did not send an admission decision.
+const (
+	outcomeError   = "error"   // the request failed after being parsed, or its response could not be sent
+	outcomeInvalid = "invalid" // the request was rejected for its method or Content-Type before being parsed
 )
 
-var (
-	mutatedCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "toleration_webhook_total",
-			Help: "Total number of k8s objects mutated by the toleration webhook",
-		},
-		[]string{"event_type", "obj_type", "name", "namespace", "mutated"},
-	)
+// Label values standing in for request kinds and operations, which come from request input and are not trusted as labels.
+const (
+	labelUnknown = "unknown" // the request was not parsed
+	labelOther   = "other"   // the kind is not supported or the operation is not an admission operation
 )
 
-func init() {
-	// Register the mutatedCounter with Prometheus default registry.
-	prometheus.MustRegister(mutatedCounter)
+// requestLabels bounds the kind and operation label values of a request to the supported kinds and admission operations.
+func requestLabels(kind, operation string) (string, string) {
+	if kind != labelUnknown {
+		if _, supported := lookupKind(kind); !supported {
+			kind = labelOther
+		}
+	}
+	switch v1beta1.Operation(operation) {
+	case v1beta1.Create, v1beta1.Update, v1beta1.Delete, v1beta1.Connect:
+	default:
+		if operation != labelUnknown {
+			operation = labelOther
+		}
+	}
+	return kind, operation
+}
+
+// webhookMetrics holds the webhook's Prometheus collectors.
+type webhookMetrics struct {
+	mutatedCounter   *prometheus.CounterVec
+	panicCounter     prometheus.Counter
+	requestDuration  *prometheus.HistogramVec
+	stageErrors      *prometheus.CounterVec
+	inFlight         prometheus.Gauge
+	buildInfo        *prometheus.GaugeVec
+	policyInfo       *prometheus.GaugeVec
+	droppedDecisions *prometheus.CounterVec
+	configDrift      *prometheus.GaugeVec
+	backfill         *prometheus.CounterVec
+
+	namespaceLabel bool                   // label toleration_webhook_total with the object namespace
+	objectCounter  *prometheus.CounterVec // per-object series, nil unless object detail is enabled
+	objectSeries   *seriesLRU             // bounds the number of objectCounter series
+}
+
+// metrics are the collectors the webhook records to. Tests swap them for fresh ones to assert values in isolation.
+var metrics = newWebhookMetrics(true, 0)
+
+// newWebhookMetrics returns a new, unregistered set of webhook collectors.
+// toleration_webhook_total is labelled with the namespace when namespaceLabel is set. With objectDetailLimit
+// above 0, toleration_webhook_object_total tracks the most recently admitted objects, up to that many series.
+func newWebhookMetrics(namespaceLabel bool, objectDetailLimit int) *webhookMetrics {
+	labels := []string{"operation", "kind", "rule", "result"}
+	if namespaceLabel {
+		labels = []string{"operation", "kind", "namespace", "rule", "result"}
+	}
+
+	m := &webhookMetrics{
+		mutatedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "toleration_webhook_total",
+				Help: "Total number of admission requests handled by the toleration webhook, by decision",
+			},
+			labels,
+		),
+		panicCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "toleration_webhook_panics_total",
+				Help: "Total number of panics recovered while handling webhook requests",
+			},
+		),
+		requestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "toleration_webhook_request_duration_seconds",
+				Help: "Duration of webhook requests by kind, operation and outcome",
+				// Buckets reach the 30s maximum timeoutSeconds of the API server.
+				Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30},
+			},
+			[]string{"kind", "operation", "outcome"},
+		),
+		stageErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "toleration_webhook_errors_total",
+				Help: "Total number of webhook request failures by handling stage: validate, parse, build or send",
+			},
+			[]string{"stage"},
+		),
+		inFlight: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "toleration_webhook_in_flight_requests",
+				Help: "Number of webhook requests currently being handled",
+			},
+		),
+		buildInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "toleration_webhook_build_info",
+				Help: "Build details of the running toleration webhook, always 1",
+			},
+			[]string{"version", "commit", "go_version"},
+		),
+		policyInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "toleration_webhook_policy_info",
+				Help: "Hash and rule count of the policy loaded by the toleration webhook, always 1",
+			},
+			[]string{"hash", "rules"},
+		),
+		droppedDecisions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "toleration_webhook_decisions_dropped_total",
+				Help: "Total number of admission decisions dropped by a decision sink because its queue was full",
+			},
+			[]string{"sink"},
+		),
+		configDrift: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "toleration_webhook_config_drift",
+				Help: "Whether the MutatingWebhookConfiguration drifted from this webhook, by check: 1 drifted, 0 ok",
+			},
+			[]string{"check"},
+		),
+		backfill: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "toleration_webhook_backfill_total",
+				Help: "Total number of existing workloads missing the toleration found by the backfill controller, by result: patched, dry_run, deferred or failed",
+			},
+			[]string{"kind", "result"},
+		),
+		namespaceLabel: namespaceLabel,
+	}
+
+	info := currentVersionInfo()
+	m.buildInfo.WithLabelValues(info.Version, info.Commit, info.GoVersion).Set(1)
+	m.policyInfo.WithLabelValues(info.PolicyHash, strconv.Itoa(info.PolicyRules)).Set(1)
+
+	if objectDetailLimit > 0 {
+		m.objectCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "toleration_webhook_object_total",
+				Help: "Admission requests handled by the toleration webhook per object, for the most recently admitted objects only",
+			},
+			[]string{"operation", "kind", "namespace", "name", "result"},
+		)
+		m.objectSeries = newSeriesLRU(objectDetailLimit, func(labels []string) {
+			m.objectCounter.DeleteLabelValues(labels...)
+		})
+	}
+
+	return m
+}
+
+// collectors returns every collector of the webhook metrics.
+func (m *webhookMetrics) collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{m.mutatedCounter, m.panicCounter, m.requestDuration, m.stageErrors, m.inFlight, m.buildInfo, m.policyInfo, m.droppedDecisions, m.configDrift, m.backfill}
+	if m.objectCounter != nil {
+		collectors = append(collectors, m.objectCounter)
+	}
+	return collectors
+}
+
+// newMetricsRegistry returns a registry with the webhook metrics and the Go runtime and process collectors.
+// A dedicated registry keeps collectors registered by imported packages off the monitoring endpoint.
+func newMetricsRegistry(m *webhookMetrics) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	registry.MustRegister(m.collectors()...)
+	return registry
+}
+
+// newMonitoringRouter returns the router of the http monitoring server, serving /metrics from registry,
+// /version and, when enabled, the net/http/pprof and expvar endpoints under /debug.
+func newMonitoringRouter(parameters serverParameters, registry *prometheus.Registry) *mux.Router {
+	router := mux.NewRouter()
+	router.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+	router.HandleFunc("/version", versionHandler)
+
+	if parameters.enablePprof {
+		router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	}
+	if parameters.enableExpvar {
+		router.Handle("/debug/vars", expvar.Handler())
+	}
+
+	return router
+}
+
+// RecordObject counts an admission decision. Per-object series are only recorded when object detail is enabled.
+func RecordObject(operation, kind, namespace, name, rule, result string) {
+	kind, operation = requestLabels(kind, operation)
+	if metrics.namespaceLabel {
+		metrics.mutatedCounter.WithLabelValues(operation, kind, namespace, rule, result).Inc()
+	} else {
+		metrics.mutatedCounter.WithLabelValues(operation, kind, rule, result).Inc()
+	}
+
+	if metrics.objectCounter != nil {
+		labels := []string{operation, kind, namespace, name, result}
+		metrics.objectSeries.touch(labels, func() { metrics.objectCounter.WithLabelValues(labels...).Inc() })
+	}
+}
+
+// RecordPanic counts a recovered panic.
+func RecordPanic() {
+	metrics.panicCounter.Inc()
+}
+
+// RecordDuration observes the duration of a webhook request.
+func RecordDuration(kind, operation, outcome string, duration time.Duration) {
+	kind, operation = requestLabels(kind, operation)
+	metrics.requestDuration.WithLabelValues(kind, operation, outcome).Observe(duration.Seconds())
+}
+
+// RecordError counts a webhook request failure at the given handling stage.
+func RecordError(stage string) {
+	metrics.stageErrors.WithLabelValues(stage).Inc()
+}
+
+// RecordDroppedDecision counts an admission decision the given sink dropped.
+func RecordDroppedDecision(sink string) {
+	metrics.droppedDecisions.WithLabelValues(sink).Inc()
+}
+
+// RecordDrift sets whether the given drift check of the MutatingWebhookConfiguration failed.
+func RecordDrift(check string, drifted bool) {
+	value := 0.0
+	if drifted {
+		value = 1
+	}
+	metrics.configDrift.WithLabelValues(check).Set(value)
 }
 
-func RecordObject(event_type, obj_type, name, namespace, mutated string) {
-	mutatedCounter.WithLabelValues(event_type, obj_type, name, namespace, mutated).Inc()
+// RecordBackfill counts an existing workload the backfill controller found missing the toleration, by result.
+func RecordBackfill(kind, result string) {
+	metrics.backfill.WithLabelValues(kind, result).Inc()
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// useTestMetrics swaps the webhook metrics for fresh collectors registered in a dedicated registry
+// for the duration of the test.
+func useTestMetrics(t *testing.T) *prometheus.Registry {
+	previous := metrics
+	metrics = newWebhookMetrics(true, 0)
+	t.Cleanup(func() { metrics = previous })
+	return newMetricsRegistry(metrics)
+}
+
+// TestMonitoringRouterMetrics tests that /metrics serves the webhook metrics from its own registry.
+func TestMonitoringRouterMetrics(t *testing.T) {
+	registry := useTestMetrics(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", "")))
+	req.Header.Set("Content-Type", jsonContentType)
+	webhookHandler(httptest.NewRecorder(), req)
+
+	expected := `
+# HELP toleration_webhook_total Total number of admission requests handled by the toleration webhook, by decision
+# TYPE toleration_webhook_total counter
+toleration_webhook_total{kind="DaemonSet",namespace="foo",operation="CREATE",result="mutated",rule="SimulateNodeFailure"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "toleration_webhook_total"); err != nil {
+		t.Error(err)
+	}
+
+	rec := httptest.NewRecorder()
+	newMonitoringRouter(serverParameters{}, registry).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `toleration_webhook_total{kind="DaemonSet"`) {
+		t.Errorf("Expected /metrics to serve the webhook metrics, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestMonitoringRouterDebugEndpoints tests that pprof and expvar are only served when enabled.
+func TestMonitoringRouterDebugEndpoints(t *testing.T) {
+	registry := useTestMetrics(t)
+
+	testCases := []struct {
+		description    string
+		parameters     serverParameters
+		path           string
+		expectedStatus int
+	}{
+		{"pprof disabled", serverParameters{}, "/debug/pprof/", http.StatusNotFound},
+		{"pprof enabled", serverParameters{enablePprof: true}, "/debug/pprof/", http.StatusOK},
+		{"pprof named profile", serverParameters{enablePprof: true}, "/debug/pprof/heap", http.StatusOK},
+		{"expvar disabled", serverParameters{}, "/debug/vars", http.StatusNotFound},
+		{"expvar enabled", serverParameters{enableExpvar: true}, "/debug/vars", http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newMonitoringRouter(testCase.parameters, registry).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, testCase.path, nil))
+			if rec.Code != testCase.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", testCase.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+// TestRecordObjectCardinality tests the namespace label can be dropped and per-object series are capped.
+func TestRecordObjectCardinality(t *testing.T) {
+	previous := metrics
+	metrics = newWebhookMetrics(false, 2)
+	t.Cleanup(func() { metrics = previous })
+	registry := newMetricsRegistry(metrics)
+
+	RecordObject("CREATE", "Deployment", "foo", "dep-a", "SimulateNodeFailure", decisionMutated)
+	RecordObject("CREATE", "Deployment", "bar", "dep-b", "SimulateNodeFailure", decisionMutated)
+	RecordObject("UPDATE", "Deployment", "foo", "dep-a", "SimulateNodeFailure", decisionUnchanged)
+	RecordObject("CREATE", "Deployment", "foo", "dep-c", "SimulateNodeFailure", decisionMutated)
+
+	expected := `
+# HELP toleration_webhook_object_total Admission requests handled by the toleration webhook per object, for the most recently admitted objects only
+# TYPE toleration_webhook_object_total counter
+toleration_webhook_object_total{kind="Deployment",name="dep-a",namespace="foo",operation="UPDATE",result="unchanged"} 1
+toleration_webhook_object_total{kind="Deployment",name="dep-c",namespace="foo",operation="CREATE",result="mutated"} 1
+# HELP toleration_webhook_total Total number of admission requests handled by the toleration webhook, by decision
+# TYPE toleration_webhook_total counter
+toleration_webhook_total{kind="Deployment",operation="CREATE",result="mutated",rule="SimulateNodeFailure"} 3
+toleration_webhook_total{kind="Deployment",operation="UPDATE",result="unchanged",rule="SimulateNodeFailure"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "toleration_webhook_total", "toleration_webhook_object_total"); err != nil {
+		t.Error(err)
+	}
+
+	// Concurrent decisions never leave more series than the cap.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				RecordObject("CREATE", "Deployment", "foo", "dep-"+strconv.Itoa(i*20+j%3), "SimulateNodeFailure", decisionMutated)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if count := testutil.CollectAndCount(metrics.objectCounter); count != 2 {
+		t.Errorf("Expected 2 per-object series, got %d", count)
+	}
+}
+
+// TestRequestDurationAndStageErrors tests request durations are observed by bounded labels and failures counted by stage.
+func TestRequestDurationAndStageErrors(t *testing.T) {
+	useTestMetrics(t)
+
+	requests := []struct {
+		contentType string
+		body        string
+	}{
+		{jsonContentType, makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "")},
+		{jsonContentType, makeAdmissionRequest("Deployment", "UPDATE", "foo/test-dep", "SimulateNodeFailure")},
+		{jsonContentType, makeAdmissionRequest("StatefulSet", "CREATE", "foo/test-sts", "")},
+		{jsonContentType, makeAdmissionRequest("Pod", "PATCH", "foo/test-pod", "")},
+		{jsonContentType, `{"kind": "AdmissionReview", "apiVersion": "admission.k8s.io/v1beta1"}`},
+		{"text/plain", makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "")},
+	}
+	for _, request := range requests {
+		req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(request.body))
+		req.Header.Set("Content-Type", request.contentType)
+		webhookHandler(httptest.NewRecorder(), req)
+	}
+
+	for _, labels := range [][]string{
+		{"Deployment", "CREATE", decisionMutated},
+		{"Deployment", "UPDATE", decisionUnchanged},
+		{labelOther, "CREATE", decisionIgnored},
+		{labelOther, labelOther, decisionIgnored},
+		{labelUnknown, labelUnknown, decisionDenied},
+		{labelUnknown, labelUnknown, outcomeInvalid},
+	} {
+		var observed dto.Metric
+		if err := metrics.requestDuration.WithLabelValues(labels...).(prometheus.Metric).Write(&observed); err != nil {
+			t.Fatal(err)
+		}
+		if count := observed.GetHistogram().GetSampleCount(); count != 1 {
+			t.Errorf("Expected 1 observed duration for %v, got %d", labels, count)
+		}
+	}
+
+	for stage, expected := range map[string]float64{stageValidate: 1, stageParse: 1, stageBuild: 0, stageSend: 0} {
+		if count := testutil.ToFloat64(metrics.stageErrors.WithLabelValues(stage)); count != expected {
+			t.Errorf("Expected %v errors at stage %s, got %v", expected, stage, count)
+		}
+	}
+	if inFlight := testutil.ToFloat64(metrics.inFlight); inFlight != 0 {
+		t.Errorf("Expected no requests in flight, got %v", inFlight)
+	}
+}
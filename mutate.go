@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of the mutate subcommand.
+const (
+	mutateOutputManifests = "manifests"
+	mutateOutputPatch     = "patch"
+	mutateOutputDiff      = "diff"
+)
+
+// mutation is the outcome of applying the policy to a manifest.
+type mutation struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name"`
+	Action    string          `json:"action"`
+	Patch     json.RawMessage `json:"patch,omitempty"`
+	Warnings  []string        `json:"warnings,omitempty"`
+	Mutated   json.RawMessage `json:"-"`
+}
+
+// mutateManifest applies the policy requiring the given toleration to the JSON manifest raw through buildResponse,
+// as /mutate would on its creation, and returns the patch and the patched manifest.
+// Manifests of other API versions than apps/v1 are ignored, since the webhook is only registered for apps/v1.
+func mutateManifest(raw []byte, required corev1.Toleration) (mutation, error) {
+	var object metav1.PartialObjectMetadata
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return mutation{}, fmt.Errorf("could not decode manifest: %s", err.Error())
+	}
+	gvk := object.GroupVersionKind()
+	if object.APIVersion != appsv1.SchemeGroupVersion.String() {
+		return mutation{Kind: gvk.Kind, Namespace: object.Namespace, Name: object.Name, Action: decisionIgnored, Mutated: raw}, nil
+	}
+	review := v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			UID:       "offline",
+			Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+			Operation: v1beta1.Create,
+			Namespace: object.Namespace,
+			Name:      object.Name,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+	response, err := buildResponse(context.Background(), review, required)
+	if err != nil {
+		return mutation{}, fmt.Errorf("%s %s: %s", gvk.Kind, object.Name, err.Error())
+	}
+
+	m := mutation{
+		Kind:      gvk.Kind,
+		Namespace: object.Namespace,
+		Name:      object.Name,
+		Action:    responseOutcome(gvk.Kind, response),
+		Patch:     response.Response.Patch,
+		Warnings:  response.Response.Warnings,
+		Mutated:   raw,
+	}
+	if m.Patch != nil {
+		patch, err := jsonpatch.DecodePatch(m.Patch)
+		if err != nil {
+			return mutation{}, fmt.Errorf("could not decode patch: %s", err.Error())
+		}
+		if m.Mutated, err = patch.Apply(raw); err != nil {
+			return mutation{}, fmt.Errorf("could not apply patch to %s %s: %s", m.Kind, m.Name, err.Error())
+		}
+	}
+	return m, nil
+}
+
+// readManifests reads the YAML or JSON documents of r, returning each as JSON. Empty documents are skipped.
+func readManifests(r io.Reader) ([][]byte, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	var manifests [][]byte
+	for {
+		var manifest json.RawMessage
+		err := decoder.Decode(&manifest)
+		if errors.Is(err, io.EOF) {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read manifests: %s", err.Error())
+		}
+		if trimmed := bytes.TrimSpace(manifest); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+			manifests = append(manifests, manifest)
+		}
+	}
+}
+
+// readManifestFile reads the manifests of file, or of stdin for "-".
+func readManifestFile(file string, stdin io.Reader) ([][]byte, error) {
+	input := stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		input = f
+	}
+	manifests, err := readManifests(input)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return manifests, nil
+}
+
+// runMutate implements the mutate subcommand: it applies the policy to the manifests in the files given as arguments,
+// or stdin without arguments or for "-", and writes the mutated manifests, their JSON patches or a diff to stdout.
+func runMutate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("mutate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("output", mutateOutputManifests, "Output: manifests (mutated YAML documents), patch (a JSON line per mutated manifest) or diff (unified diff).")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: webhook mutate [--output=manifests|patch|diff] [FILE|-]...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	switch *output {
+	case mutateOutputManifests, mutateOutputPatch, mutateOutputDiff:
+	default:
+		fmt.Fprintf(stderr, "invalid output %q\n", *output)
+		return 2
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var manifests [][]byte
+	for _, file := range files {
+		read, err := readManifestFile(file, stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		manifests = append(manifests, read...)
+	}
+
+	for i, manifest := range manifests {
+		m, err := mutateManifest(manifest, toleration)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if err := writeMutation(stdout, *output, i, manifest, m); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// writeMutation writes the i-th mutation m of manifest to w in the given output format.
+func writeMutation(w io.Writer, output string, i int, manifest []byte, m mutation) error {
+	switch output {
+	case mutateOutputPatch:
+		if m.Patch == nil {
+			return nil
+		}
+		line, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", line)
+		return err
+
+	case mutateOutputDiff:
+		if m.Patch == nil {
+			return nil
+		}
+		original, err := yaml.JSONToYAML(manifest)
+		if err != nil {
+			return err
+		}
+		mutated, err := yaml.JSONToYAML(m.Mutated)
+		if err != nil {
+			return err
+		}
+		name := strings.Trim(strings.Join([]string{m.Kind, m.Namespace, m.Name}, "/"), "/")
+		return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+			A:        difflib.SplitLines(strings.TrimSuffix(string(original), "\n")),
+			B:        difflib.SplitLines(strings.TrimSuffix(string(mutated), "\n")),
+			FromFile: "a/" + name,
+			ToFile:   "b/" + name,
+			Context:  3,
+		})
+
+	default:
+		mutated, err := yaml.JSONToYAML(m.Mutated)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		_, err = w.Write(mutated)
+		return err
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-dep
+  namespace: foo
+spec:
+  template:
+    spec:
+      containers:
+      - image: nginx
+        name: web
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: test-ds
+  namespace: foo
+spec:
+  template:
+    spec:
+      tolerations:
+      - effect: NoExecute
+        key: SimulateNodeFailure
+        operator: Exists
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-cm
+`
+
+// TestRunMutate tests the mutate subcommand outputs for YAML and JSON manifests.
+func TestRunMutate(t *testing.T) {
+	useTestMetrics(t)
+
+	testCases := []struct {
+		description string
+		args        []string
+		input       string
+		expected    string
+	}{
+		{
+			description: "manifests",
+			args:        nil,
+			input:       testManifests,
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    updated_by: tolerationWebhook
+  name: test-dep
+  namespace: foo
+spec:
+  template:
+    spec:
+      containers:
+      - image: nginx
+        name: web
+      tolerations:
+      - effect: NoExecute
+        key: SimulateNodeFailure
+        operator: Exists
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: test-ds
+  namespace: foo
+spec:
+  template:
+    spec:
+      tolerations:
+      - effect: NoExecute
+        key: SimulateNodeFailure
+        operator: Exists
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-cm
+`,
+		},
+		{
+			description: "diff",
+			args:        []string{"--output=diff", "-"},
+			input:       testManifests,
+			expected: `--- a/Deployment/foo/test-dep
++++ b/Deployment/foo/test-dep
+@@ -1,6 +1,8 @@
+ apiVersion: apps/v1
+ kind: Deployment
+ metadata:
++  annotations:
++    updated_by: tolerationWebhook
+   name: test-dep
+   namespace: foo
+ spec:
+@@ -9,3 +11,7 @@
+       containers:
+       - image: nginx
+         name: web
++      tolerations:
++      - effect: NoExecute
++        key: SimulateNodeFailure
++        operator: Exists
+`,
+		},
+		{
+			description: "patch from JSON",
+			args:        []string{"--output=patch"},
+			input:       `{"apiVersion":"apps/v1","kind":"DaemonSet","metadata":{"name":"test-ds","namespace":"foo","annotations":{"a":"b"}},"spec":{"template":{"spec":{}}}}`,
+			expected: `{"kind":"DaemonSet","namespace":"foo","name":"test-ds","action":"mutated","patch":[{"op":"replace","path":"/spec/template/spec/tolerations","value":[{"key":"SimulateNodeFailure","operator":"Exists","effect":"NoExecute"}]},{"op":"replace","path":"/metadata/annotations","value":{"a":"b","updated_by":"tolerationWebhook"}}],"warnings":["DaemonSet foo/test-ds does not have a toleration set.","DaemonSet foo/test-ds was updated with toleration."]}
+`,
+		},
+		{
+			description: "patch ignores other API versions",
+			args:        []string{"--output=patch"},
+			input:       `{"apiVersion":"extensions/v1beta1","kind":"Deployment","metadata":{"name":"test-dep","namespace":"foo"},"spec":{"template":{"spec":{}}}}`,
+			expected:    "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runMutate(testCase.args, strings.NewReader(testCase.input), &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+			}
+			if stdout.String() != testCase.expected {
+				t.Errorf("Expected output:\n%s\ngot:\n%s", testCase.expected, stdout.String())
+			}
+		})
+	}
+}
+
+// TestRunMutateFiles tests manifests are read from every file argument and errors are reported.
+func TestRunMutateFiles(t *testing.T) {
+	useTestMetrics(t)
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.yaml": testManifests, "b.json": `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"other"},"spec":{"template":{"spec":{}}}}`} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runMutate([]string{"--output=patch", filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.json")}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		var m mutation
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, m.Name)
+	}
+	if strings.Join(names, ",") != "test-dep,other" {
+		t.Errorf("Expected patches for test-dep and other, got %v", names)
+	}
+
+	for _, args := range [][]string{{filepath.Join(dir, "missing.yaml")}, {"--output=xml"}} {
+		if code := runMutate(args, strings.NewReader(""), &stdout, &stderr); code == 0 {
+			t.Errorf("Expected a non-zero exit code for %v", args)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const tolerationPolicyKind = "TolerationPolicy"
+
+// tolerationPolicy is a TolerationPolicy with the toleration required on supported workloads in spec.toleration.
+// The webhook reads it from --policyFile and the KRM function from its functionConfig.
+// kpt's key=value function arguments, passed as a ConfigMap, are accepted too.
+type tolerationPolicy struct {
+	metav1.TypeMeta `json:",inline"`
+	Spec            struct {
+		Toleration corev1.Toleration `json:"toleration"`
+	} `json:"spec"`
+	Data map[string]string `json:"data"`
+}
+
+// parseTolerationPolicy returns the toleration required by the YAML or JSON policy in data.
+func parseTolerationPolicy(data []byte) (corev1.Toleration, error) {
+	var policy tolerationPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return corev1.Toleration{}, err
+	}
+
+	required := policy.Spec.Toleration
+	switch policy.Kind {
+	case tolerationPolicyKind:
+	case "ConfigMap":
+		required = corev1.Toleration{
+			Key:      policy.Data["key"],
+			Operator: corev1.TolerationOperator(policy.Data["operator"]),
+			Value:    policy.Data["value"],
+			Effect:   corev1.TaintEffect(policy.Data["effect"]),
+		}
+	default:
+		return corev1.Toleration{}, fmt.Errorf("kind must be %s or ConfigMap, got %q", tolerationPolicyKind, policy.Kind)
+	}
+	if required.Key == "" {
+		return corev1.Toleration{}, fmt.Errorf("toleration key is required")
+	}
+	if required.Operator == "" {
+		required.Operator = corev1.TolerationOpExists
+	}
+	return required, nil
+}
+
+// readTolerationPolicy returns the toleration required by the policy file at path.
+func readTolerationPolicy(path string) (corev1.Toleration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return corev1.Toleration{}, fmt.Errorf("could not read policy file: %s", err.Error())
+	}
+	required, err := parseTolerationPolicy(data)
+	if err != nil {
+		return corev1.Toleration{}, fmt.Errorf("invalid policy file %s: %s", path, err.Error())
+	}
+	return required, nil
+}
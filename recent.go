@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// decisionRing keeps the most recent admission decisions in memory and serves them as JSON.
+type decisionRing struct {
+	mu      sync.Mutex
+	entries []decision
+	next    int
+	full    bool
+}
+
+// newDecisionRing returns a ring keeping the last size decisions.
+func newDecisionRing(size int) *decisionRing {
+	return &decisionRing{entries: make([]decision, size)}
+}
+
+// Record keeps d, replacing the oldest decision once the ring is full.
+func (r *decisionRing) Record(d decision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = d
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the kept decisions, newest first.
+func (r *decisionRing) list() []decision {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := r.next
+	if r.full {
+		count = len(r.entries)
+	}
+	decisions := make([]decision, 0, count)
+	for i := 1; i <= count; i++ {
+		decisions = append(decisions, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return decisions
+}
+
+// ServeHTTP serves the kept decisions newest first, filtered by the namespace, kind and action query parameters.
+func (r *decisionRing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filters := map[string]func(decision) string{
+		"namespace": func(d decision) string { return d.Namespace },
+		"kind":      func(d decision) string { return d.Kind },
+		"action":    func(d decision) string { return d.Action },
+	}
+
+	decisions := []decision{}
+	for _, d := range r.list() {
+		matches := true
+		for name, field := range filters {
+			if value := query.Get(name); value != "" && field(d) != value {
+				matches = false
+			}
+		}
+		if matches {
+			decisions = append(decisions, d)
+		}
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(decisions)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TestDecisionRing tests that the ring keeps the most recent decisions, newest first.
+func TestDecisionRing(t *testing.T) {
+	ring := newDecisionRing(2)
+	if decisions := ring.list(); len(decisions) != 0 {
+		t.Fatalf("Expected no decisions, got %v", decisions)
+	}
+
+	for _, uid := range []string{"1", "2", "3"} {
+		ring.Record(decision{UID: types.UID(uid)})
+	}
+	decisions := ring.list()
+	if len(decisions) != 2 || decisions[0].UID != "3" || decisions[1].UID != "2" {
+		t.Errorf("Expected decisions 3 and 2, got %v", decisions)
+	}
+}
+
+// TestDecisionRingHandler tests /debug/decisions serves the handler's decisions with their patch and warnings, filtered by query.
+func TestDecisionRingHandler(t *testing.T) {
+	useTestMetrics(t)
+	ring := newDecisionRing(10)
+	decisionSinks = []decisionSink{ring}
+	t.Cleanup(func() { decisionSinks = nil })
+
+	for _, request := range []string{
+		makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", ""),
+		makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "SimulateNodeFailure"),
+		makeAdmissionRequest("Deployment", "CREATE", "bar/test-dep", ""),
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(request))
+		req.Header.Set("Content-Type", jsonContentType)
+		webhookHandler(httptest.NewRecorder(), req)
+	}
+
+	testCases := []struct {
+		query         string
+		expectedNames []string
+	}{
+		{"", []string{"bar/test-dep", "foo/test-dep", "foo/test-ds"}},
+		{"?namespace=foo", []string{"foo/test-dep", "foo/test-ds"}},
+		{"?kind=Deployment&action=mutated", []string{"bar/test-dep"}},
+		{"?action=denied", []string{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ring.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/decisions"+testCase.query, nil))
+			var decisions []decision
+			if err := json.Unmarshal(rec.Body.Bytes(), &decisions); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, d := range decisions {
+				names = append(names, d.Namespace+"/"+d.Name)
+				if d.Action == decisionMutated && (d.Patch == nil || len(d.Warnings) != 2) {
+					t.Errorf("Expected the patch and warnings of mutated decisions, got %+v", d)
+				}
+			}
+			if len(names) != len(testCase.expectedNames) {
+				t.Fatalf("Expected %v, got %v", testCase.expectedNames, names)
+			}
+			for i := range names {
+				if names[i] != testCase.expectedNames[i] {
+					t.Errorf("Expected %v, got %v", testCase.expectedNames, names)
+				}
+			}
+		})
+	}
+}
+
+// TestDecisionRingHandlerRedactsSecrets tests /debug/decisions does not serve secret annotations from the patch.
+func TestDecisionRingHandlerRedactsSecrets(t *testing.T) {
+	useTestMetrics(t)
+	ring := newDecisionRing(10)
+	decisionSinks = []decisionSink{ring}
+	t.Cleanup(func() { decisionSinks = nil })
+
+	request := makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "")
+	request = strings.Replace(request, `"some_annotation": "some_value"`, `"api-token": "s3cr3t"`, 1)
+	req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(request))
+	req.Header.Set("Content-Type", jsonContentType)
+	webhookHandler(httptest.NewRecorder(), req)
+
+	rec := httptest.NewRecorder()
+	ring.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/decisions", nil))
+	var decisions []decision
+	if err := json.Unmarshal(rec.Body.Bytes(), &decisions); err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 1 || decisions[0].Patch == nil {
+		t.Fatalf("Expected one decision with a patch, got %+v", decisions)
+	}
+	if strings.Contains(string(decisions[0].Patch), "s3cr3t") || !strings.Contains(string(decisions[0].Patch), redactedValue) {
+		t.Errorf("Expected the api-token annotation to be redacted, got %s", decisions[0].Patch)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of the simulate subcommand.
+const (
+	simulateOutputText = "text"
+	simulateOutputJSON = "json"
+)
+
+// simulation is the outcome of replaying an AdmissionReview through webhookHandler.
+type simulation struct {
+	Status   int                        `json:"status"`
+	Response *v1beta1.AdmissionResponse `json:"response,omitempty"`
+	Patch    json.RawMessage            `json:"patch,omitempty"`
+	Warnings []string                   `json:"warnings,omitempty"`
+	Mutated  json.RawMessage            `json:"mutated,omitempty"`
+}
+
+// simulateReview sends the YAML or JSON AdmissionReview raw to webhookHandler in-process, as the API server would,
+// and returns its response with the decoded patch applied to the request object.
+func simulateReview(raw []byte) (simulation, error) {
+	body, err := yaml.YAMLToJSON(raw)
+	if err != nil {
+		return simulation{}, fmt.Errorf("could not read AdmissionReview: %s", err.Error())
+	}
+	var review v1beta1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil {
+		return simulation{}, fmt.Errorf("could not decode AdmissionReview: %s", err.Error())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, webhookPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", jsonContentType)
+	rec := httptest.NewRecorder()
+	webhookHandler(rec, req)
+
+	s := simulation{Status: rec.Code}
+	if rec.Code != http.StatusOK {
+		return s, fmt.Errorf("webhook answered %d: %s", rec.Code, bytes.TrimSpace(rec.Body.Bytes()))
+	}
+	var response v1beta1.AdmissionReview
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		return s, fmt.Errorf("could not decode response: %s", err.Error())
+	}
+	s.Response = response.Response
+	if s.Response == nil {
+		return s, nil
+	}
+	s.Warnings = s.Response.Warnings
+
+	if s.Response.Patch != nil {
+		s.Patch = s.Response.Patch
+		if review.Request == nil || review.Request.Object.Raw == nil {
+			return s, fmt.Errorf("response carries a patch but the request has no object")
+		}
+		patch, err := jsonpatch.DecodePatch(s.Patch)
+		if err != nil {
+			return s, fmt.Errorf("could not decode patch: %s", err.Error())
+		}
+		if s.Mutated, err = patch.Apply(review.Request.Object.Raw); err != nil {
+			return s, fmt.Errorf("could not apply patch: %s", err.Error())
+		}
+	}
+	return s, nil
+}
+
+// runSimulate implements the simulate subcommand: it replays the AdmissionReview in the file given as argument,
+// or stdin without one or for "-", through the webhook and prints the response, patch, warnings and mutated object.
+func runSimulate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("output", simulateOutputText, "Output: text (sections for humans) or json.")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: webhook simulate [--output=text|json] [FILE|-]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output != simulateOutputText && *output != simulateOutputJSON {
+		fmt.Fprintf(stderr, "invalid output %q\n", *output)
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	input := stdin
+	if file := fs.Arg(0); file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		input = f
+	}
+	raw, err := io.ReadAll(input)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	s, err := simulateReview(raw)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := writeSimulation(stdout, *output, s); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// writeSimulation writes s to w in the given output format.
+func writeSimulation(w io.Writer, output string, s simulation) error {
+	if output == simulateOutputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	}
+
+	// The response is printed without its base64 patch and warnings, which have their own sections.
+	var response v1beta1.AdmissionResponse
+	if s.Response != nil {
+		response = *s.Response
+		response.Patch, response.Warnings = nil, nil
+	}
+	sections := []struct {
+		title string
+		value any
+	}{
+		{"Response", response},
+		{"Patch", s.Patch},
+		{"Warnings", s.Warnings},
+		{"Mutated object", s.Mutated},
+	}
+	for i, section := range sections {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		text := []byte("none\n")
+		if value, err := json.Marshal(section.value); err != nil {
+			return err
+		} else if string(value) != "null" {
+			if text, err = yaml.JSONToYAML(value); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s:\n%s", section.title, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// TestSimulateReview tests an AdmissionReview is replayed through webhookHandler with its patch decoded and applied.
+func TestSimulateReview(t *testing.T) {
+	useTestMetrics(t)
+
+	s, err := simulateReview([]byte(makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", "TestToleration")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != 200 || s.Response == nil || !s.Response.Allowed {
+		t.Fatalf("Expected an allowed response, got %+v", s)
+	}
+	expectedPatch := `[{"op":"replace","path":"/spec/template/spec/tolerations","value":[{"key":"TestToleration","operator":"Exists","effect":"NoExecute"},{"key":"SimulateNodeFailure","operator":"Exists","effect":"NoExecute"}]},{"op":"replace","path":"/metadata/annotations","value":{"some_annotation":"some_value","updated_by":"tolerationWebhook"}}]`
+	if string(s.Patch) != expectedPatch {
+		t.Errorf("Expected patch %s, got %s", expectedPatch, s.Patch)
+	}
+	if len(s.Warnings) != 2 {
+		t.Errorf("Expected 2 warnings, got %v", s.Warnings)
+	}
+
+	var mutated appsv1.Deployment
+	if err := json.Unmarshal(s.Mutated, &mutated); err != nil {
+		t.Fatal(err)
+	}
+	if tolerations := mutated.Spec.Template.Spec.Tolerations; len(tolerations) != 2 || tolerations[1].Key != "SimulateNodeFailure" {
+		t.Errorf("Expected the mutated object to carry the webhook toleration, got %v", tolerations)
+	}
+	if mutated.Annotations["updated_by"] != "tolerationWebhook" {
+		t.Errorf("Expected the mutated object to be annotated, got %v", mutated.Annotations)
+	}
+}
+
+// TestRunSimulate tests the sections printed by the simulate subcommand and its exit codes.
+func TestRunSimulate(t *testing.T) {
+	useTestMetrics(t)
+
+	testCases := []struct {
+		description      string
+		args             []string
+		input            string
+		expectedCode     int
+		expectedContains []string
+	}{
+		{
+			description:      "mutated",
+			input:            makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", ""),
+			expectedContains: []string{"Response:\nallowed: true\n", "action: mutated", "Patch:\n- op: replace\n  path: /spec/template/spec/tolerations", "Warnings:\n- DaemonSet foo/test-ds does not have a toleration set.", "Mutated object:\napiVersion: apps/v1"},
+		},
+		{
+			description:      "unchanged",
+			input:            makeAdmissionRequest("DaemonSet", "UPDATE", "foo/test-ds", "SimulateNodeFailure"),
+			expectedContains: []string{"action: unchanged", "Patch:\nnone\n", "Warnings:\nnone\n", "Mutated object:\nnone\n"},
+		},
+		{
+			description:      "json",
+			args:             []string{"--output=json"},
+			input:            makeAdmissionRequest("Deployment", "CREATE", "foo/test-dep", ""),
+			expectedContains: []string{`"status": 200`, `"patch": [`, `"mutated": {`},
+		},
+		{
+			description:      "denied",
+			input:            `{"kind": "AdmissionReview", "apiVersion": "admission.k8s.io/v1beta1"}`,
+			expectedContains: []string{"allowed: false", "malformed admission review (request is nil)"},
+		},
+		{
+			description:  "invalid output",
+			args:         []string{"--output=yaml"},
+			expectedCode: 2,
+		},
+		{
+			description:  "not an AdmissionReview",
+			input:        "- a\n- b\n",
+			expectedCode: 1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runSimulate(testCase.args, strings.NewReader(testCase.input), &stdout, &stderr); code != testCase.expectedCode {
+				t.Fatalf("Expected exit code %d, got %d: %s", testCase.expectedCode, code, stderr.String())
+			}
+			for _, expected := range testCase.expectedContains {
+				if !strings.Contains(stdout.String(), expected) {
+					t.Errorf("Expected output to contain %q, got %s", expected, stdout.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/andreistefanciprian/k8s-toleration-webhook"
+
+// Span attribute keys set on admission spans.
+const (
+	attributeUID       = "admission.uid"
+	attributeOperation = "admission.operation"
+	attributeDecision  = "admission.decision"
+	attributeKind      = "k8s.kind"
+	attributeNamespace = "k8s.namespace.name"
+	attributeName      = "k8s.object.name"
+)
+
+// tracer creates the admission spans. It does not record anything until setupTracing is called.
+var tracer trace.Tracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// tracePropagator reads the W3C traceparent header the API server or a proxy sent, if any.
+var tracePropagator = propagation.TraceContext{}
+
+// setupTracing exports spans over OTLP/HTTP to endpoint, sampling sampleRatio of the traces that were not sampled upstream.
+// It returns a function flushing and stopping the exporter. An empty endpoint leaves tracing disabled.
+func setupTracing(ctx context.Context, endpoint string, sampleRatio float64) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("could not create OTLP trace exporter: %s", err.Error())
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("toleration-webhook"),
+			semconv.ServiceVersion(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(tracePropagator)
+	tracer = provider.Tracer(tracerName)
+	return provider.Shutdown, nil
+}
+
+// endSpan ends span, marking it as failed when err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useTestTracer records the admission spans in memory for the duration of the test.
+func useTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := tracer
+	tracer = provider.Tracer(tracerName)
+	t.Cleanup(func() { tracer = previous })
+	return exporter
+}
+
+// TestWebhookHandlerTracing tests the admission spans, their attributes and traceparent propagation.
+func TestWebhookHandlerTracing(t *testing.T) {
+	useTestMetrics(t)
+	exporter := useTestTracer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString(makeAdmissionRequest("DaemonSet", "CREATE", "foo/test-ds", "")))
+	req.Header.Set("Content-Type", jsonContentType)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	webhookHandler(httptest.NewRecorder(), req)
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	for _, name := range []string{"admission", "decode", "policy.evaluate", "patch.build", "encode"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("Expected a %s span, got %v", name, spans)
+		}
+		if traceID := span.SpanContext.TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected %s span in the caller's trace, got trace %s", name, traceID)
+		}
+		if name != "admission" && span.Parent.SpanID() != spans["admission"].SpanContext.SpanID() {
+			t.Errorf("Expected %s span to be a child of the admission span", name)
+		}
+	}
+	if parent := spans["admission"].Parent.SpanID().String(); parent != "00f067aa0ba902b7" {
+		t.Errorf("Expected admission span parent 00f067aa0ba902b7, got %s", parent)
+	}
+
+	attributes := map[attribute.Key]string{}
+	for _, kv := range spans["admission"].Attributes {
+		attributes[kv.Key] = kv.Value.Emit()
+	}
+	expected := map[attribute.Key]string{
+		attributeKind:      "DaemonSet",
+		attributeOperation: "CREATE",
+		attributeNamespace: "foo",
+		attributeName:      "test-ds",
+		attributeDecision:  decisionMutated,
+	}
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("Expected attribute %s=%q, got %q", key, value, attributes[key])
+		}
+	}
+}
+
+// TestWebhookHandlerTracingError tests a failed decode marks the decode span as failed.
+func TestWebhookHandlerTracingError(t *testing.T) {
+	useTestMetrics(t)
+	exporter := useTestTracer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewBufferString("{"))
+	req.Header.Set("Content-Type", jsonContentType)
+	webhookHandler(httptest.NewRecorder(), req)
+
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "decode" && span.Status.Code.String() != "Error" {
+			t.Errorf("Expected decode span status Error, got %s", span.Status.Code)
+		}
+		if span.Name == "admission" && span.Parent.IsValid() {
+			t.Error("Expected a new trace without a traceparent header")
+		}
+	}
+	if len(exporter.GetSpans()) != 3 {
+		t.Errorf("Expected admission, decode and encode spans, got %d spans", len(exporter.GetSpans()))
+	}
+}
@@ -1,11 +1,97 @@
 package main
 
+import (
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
 // ServerParameters struct holds the parameters for the webhook server.
 type serverParameters struct {
 	httpsPort int    // https server port used for webhook endpoint
 	httpPort  int    // http server port used for monitoring
 	certFile  string // path to the x509 certificate for https
 	keyFile   string // path to the x509 private key matching `CertFile`
+
+	maxRequestBytes       int64         // maximum accepted size of an AdmissionReview request body
+	maxInFlight           int           // maximum number of concurrent /mutate requests, 0 disables the cap
+	webhookTimeoutSeconds int           // timeoutSeconds configured on the MutatingWebhookConfiguration
+	readTimeout           time.Duration // https server read timeout, derived from webhookTimeoutSeconds when 0
+	writeTimeout          time.Duration // https server write timeout, derived from webhookTimeoutSeconds when 0
+	idleTimeout           time.Duration // https server keep-alive timeout, derived from webhookTimeoutSeconds when 0
+	denyOnPanic           bool          // deny admission requests whose handling panicked instead of allowing them unpatched
+	logFormat             string        // log output format: json or text
+	logLevel              string        // minimum log level: debug, info, warn or error
+	debugBodies           bool          // log AdmissionReview request and response bodies
+	debugRedactPaths      string        // comma-separated dotted JSON paths redacted from logged bodies
+	debugMaxBodyBytes     int           // maximum size of each logged body before truncation
+	debugSampleRate       float64       // fraction of requests whose bodies are logged
+	certMode              string        // where the serving certificate comes from: file or self-signed
+	kubeconfig            string        // kubeconfig file, the in-cluster config is used when empty
+	serviceName           string        // name of the Service in front of the webhook
+	serviceNamespace      string        // namespace of the webhook Service and certificate Secret
+	certSecretName        string        // Secret holding the self-signed CA and serving certificate
+	webhookConfigName     string        // name of the MutatingWebhookConfiguration pointing at this webhook
+	registerWebhook       bool          // create or update the MutatingWebhookConfiguration at startup
+	unregisterOnShutdown  bool          // delete the MutatingWebhookConfiguration on shutdown
+	caFile                string        // CA bundle written to the registered configuration in file certificate mode
+	namespaceSelector     string        // label selector of the namespaces the registered webhook applies to
+	objectSelector        string        // label selector of the objects the registered webhook applies to
+	failurePolicy         string        // failurePolicy of the registered webhook: Ignore or Fail
+	metricsNamespaceLabel bool          // label toleration_webhook_total with the object namespace
+	metricsObjectLimit    int           // maximum number of per-object series, 0 disables per-object metrics
+	enablePprof           bool          // serve net/http/pprof endpoints on the monitoring server
+	enableExpvar          bool          // serve expvar endpoint on the monitoring server
+	configFile            string        // YAML config file keyed by flag name
+	printConfig           bool          // print the effective configuration and exit
+	printVersion          bool          // print the build and policy details and exit
+	otlpEndpoint          string        // OTLP/HTTP endpoint URL spans are exported to, empty disables tracing
+	traceSampleRatio      float64       // ratio of new traces to sample
+	recordEvents          bool          // record Events on mutated workloads
+	eventQPS              float64       // sustained rate of Events per object
+	eventBurst            int           // burst of Events per object
+	decisionLogFile       string        // JSONL file admission decisions are written to, empty disables it
+	decisionLogMaxBytes   int64         // size at which the decision log is rotated
+	decisionLogMaxAge     time.Duration // age at which the decision log is rotated
+	decisionLogMaxBackups int           // number of rotated decision logs kept
+	decisionLogQueue      int           // number of decisions queued for writing before new ones are dropped
+	recentDecisions       int           // number of recent decisions served at /debug/decisions, 0 disables it
+	coverageMetrics       bool          // report toleration coverage of existing workloads from informers
+	driftCheckInterval    time.Duration // interval of the MutatingWebhookConfiguration drift checks, 0 disables them
+	cloudEventsURL        string        // URL decisions are POSTed to as CloudEvents, empty disables it
+	cloudEventsSource     string        // CloudEvents source attribute
+	cloudEventsActions    string        // comma-separated decision actions sent as CloudEvents
+	cloudEventsSigningKey string        // HMAC-SHA256 key signing CloudEvents bodies, empty disables signing
+	cloudEventsQueue      int           // number of CloudEvents queued for sending before new ones are dropped
+	cloudEventsAttempts   int           // maximum delivery attempts per CloudEvent
+	cloudEventsBackoff    time.Duration // delay before the first retry, doubled on each retry
+	backfillInterval      time.Duration // interval of the backfill of existing workloads, 0 disables it
+	backfillDryRun        bool          // send backfill patches as dry runs only
+	backfillQPS           float64       // maximum rate of backfill patches per second
+	backfillWindow        string        // daily HH:MM-HH:MM UTC window backfill patches are sent in, empty for any time
+	backfillLeaseName     string        // Lease the backfill replicas elect a leader with, empty disables leader election
+
+	policyFile string            // TolerationPolicy file with the toleration added to workloads, empty keeps the built-in one
+	policy     corev1.Toleration // toleration read from policyFile
+}
+
+// Decisions taken by the webhook for an admission request.
+const (
+	decisionMutated   = "mutated"   // the toleration was added
+	decisionUnchanged = "unchanged" // the toleration was already set
+	decisionIgnored   = "ignored"   // the kind is not supported, the request is allowed untouched
+	decisionDenied    = "denied"    // the request could not be processed and was denied
+)
+
+// supportedKind is a workload kind the webhook adds tolerations to.
+type supportedKind struct {
+	kind      string                // Kind of the object, e.g. Deployment
+	resource  string                // plural API resource in the apps/v1 group, e.g. deployments
+	newObject func() runtime.Object // returns an empty typed object to unmarshal admission requests into
 }
 
 // patchOperation is a JSON patch operation, see https://jsonpatch.com/
@@ -14,3 +100,28 @@ type patchOperation struct {
 	Path  string      `json:"path"`
 	Value interface{} `json:"value,omitempty"`
 }
+
+// admissionError is an error reported to the API server in the status of a denied AdmissionResponse.
+type admissionError struct {
+	uid  types.UID // UID of the admission request, empty when it could not be decoded
+	code int32     // HTTP status code describing the failure
+	err  error
+}
+
+func (e *admissionError) Error() string { return e.err.Error() }
+
+func (e *admissionError) Unwrap() error { return e.err }
+
+// reason maps the status code of the admission error to a Kubernetes status reason.
+func (e *admissionError) reason() metav1.StatusReason {
+	switch e.code {
+	case http.StatusBadRequest:
+		return metav1.StatusReasonBadRequest
+	case http.StatusRequestEntityTooLarge:
+		return metav1.StatusReasonRequestEntityTooLarge
+	case http.StatusUnsupportedMediaType:
+		return metav1.StatusReasonUnsupportedMediaType
+	default:
+		return metav1.StatusReasonInternalError
+	}
+}
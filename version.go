@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Build details, set at build time with:
+// go build -ldflags "-X main.version=<version> -X main.commit=<commit>"
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+// versionInfo describes the build and policy a replica is running.
+type versionInfo struct {
+	Version     string `json:"version"`
+	Commit      string `json:"commit"`
+	GoVersion   string `json:"goVersion"`
+	PolicyHash  string `json:"policyHash"`
+	PolicyRules int    `json:"policyRules"`
+}
+
+// currentVersionInfo returns the build and policy details of this binary.
+func currentVersionInfo() versionInfo {
+	return versionInfo{
+		Version:     version,
+		Commit:      commit,
+		GoVersion:   runtime.Version(),
+		PolicyHash:  policyHash(),
+		PolicyRules: len(policyRules()),
+	}
+}
+
+// policyRules returns the tolerations the webhook enforces on supported workloads, each one a rule named after its key.
+func policyRules() []corev1.Toleration {
+	return []corev1.Toleration{toleration}
+}
+
+// policyHash returns a short hash identifying the loaded policy: the enforced tolerations and the supported kinds.
+func policyHash() string {
+	var kinds []string
+	for _, supported := range supportedKinds {
+		kinds = append(kinds, supported.kind)
+	}
+	policy, _ := json.Marshal(struct {
+		Tolerations []corev1.Toleration `json:"tolerations"`
+		Kinds       []string            `json:"kinds"`
+	}{policyRules(), kinds})
+
+	sum := sha256.Sum256(policy)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// versionHandler serves the build and policy details as JSON.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(currentVersionInfo())
+}
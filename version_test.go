@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestVersionInfo tests that /version and the info gauges expose the same build and policy details.
+func TestVersionInfo(t *testing.T) {
+	previousVersion, previousCommit := version, commit
+	version, commit = "1.2.3", "abc123"
+	t.Cleanup(func() { version, commit = previousVersion, previousCommit })
+	registry := useTestMetrics(t)
+
+	rec := httptest.NewRecorder()
+	newMonitoringRouter(serverParameters{}, registry).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	var info versionInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	expected := versionInfo{"1.2.3", "abc123", runtime.Version(), policyHash(), 1}
+	if info != expected {
+		t.Errorf("Expected %+v, got %+v", expected, info)
+	}
+
+	metrics := fmt.Sprintf(`
+# HELP toleration_webhook_build_info Build details of the running toleration webhook, always 1
+# TYPE toleration_webhook_build_info gauge
+toleration_webhook_build_info{commit="abc123",go_version="%s",version="1.2.3"} 1
+# HELP toleration_webhook_policy_info Hash and rule count of the policy loaded by the toleration webhook, always 1
+# TYPE toleration_webhook_policy_info gauge
+toleration_webhook_policy_info{hash="%s",rules="1"} 1
+`, runtime.Version(), policyHash())
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(metrics), "toleration_webhook_build_info", "toleration_webhook_policy_info"); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestPolicyHash tests that the policy hash follows the enforced toleration.
+func TestPolicyHash(t *testing.T) {
+	hash := policyHash()
+	if len(hash) != 16 || hash != policyHash() {
+		t.Fatalf("Expected a stable 16 character hash, got %q", hash)
+	}
+
+	previous := toleration
+	toleration.Key = "Other"
+	t.Cleanup(func() { toleration = previous })
+	if policyHash() == hash {
+		t.Error("Expected the policy hash to change with the toleration")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// webhookPath is the path the API server calls on the webhook service.
+const webhookPath = "/mutate"
+
+// buildWebhookConfiguration returns the MutatingWebhookConfiguration for the supported kinds
+// and the configured selectors, failurePolicy and timeout.
+// Every field the API server would default is set, so that an unchanged configuration does not look drifted.
+func buildWebhookConfiguration(parameters serverParameters, caBundle []byte) (*admissionregistrationv1.MutatingWebhookConfiguration, error) {
+	namespaceSelector, err := metav1.ParseToLabelSelector(parameters.namespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace selector %q: %s", parameters.namespaceSelector, err.Error())
+	}
+	objectSelector, err := metav1.ParseToLabelSelector(parameters.objectSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object selector %q: %s", parameters.objectSelector, err.Error())
+	}
+
+	failurePolicy := admissionregistrationv1.FailurePolicyType(parameters.failurePolicy)
+	if failurePolicy != admissionregistrationv1.Ignore && failurePolicy != admissionregistrationv1.Fail {
+		return nil, fmt.Errorf("invalid failure policy %q: must be Ignore or Fail", parameters.failurePolicy)
+	}
+
+	var resources []string
+	for _, supported := range supportedKinds {
+		resources = append(resources, supported.resource)
+	}
+
+	path := webhookPath
+	port := int32(443)
+	sideEffects := admissionregistrationv1.SideEffectClassNoneOnDryRun
+	scope := admissionregistrationv1.NamespacedScope
+	matchPolicy := admissionregistrationv1.Equivalent
+	reinvocationPolicy := admissionregistrationv1.NeverReinvocationPolicy
+	timeoutSeconds := int32(parameters.webhookTimeoutSeconds)
+
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   parameters.webhookConfigName,
+			Labels: map[string]string{"app.kubernetes.io/managed-by": "toleration-webhook"},
+		},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{
+				Name:                    parameters.serviceName + "." + parameters.serviceNamespace + ".svc.cluster.local",
+				AdmissionReviewVersions: []string{"v1beta1"},
+				SideEffects:             &sideEffects,
+				TimeoutSeconds:          &timeoutSeconds,
+				FailurePolicy:           &failurePolicy,
+				MatchPolicy:             &matchPolicy,
+				ReinvocationPolicy:      &reinvocationPolicy,
+				NamespaceSelector:       namespaceSelector,
+				ObjectSelector:          objectSelector,
+				Rules: []admissionregistrationv1.RuleWithOperations{
+					{
+						Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{"apps"},
+							APIVersions: []string{"v1"},
+							Resources:   resources,
+							Scope:       &scope,
+						},
+					},
+				},
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service: &admissionregistrationv1.ServiceReference{
+						Name:      parameters.serviceName,
+						Namespace: parameters.serviceNamespace,
+						Path:      &path,
+						Port:      &port,
+					},
+					CABundle: caBundle,
+				},
+			},
+		},
+	}, nil
+}
+
+// registerWebhookConfiguration creates the MutatingWebhookConfiguration, or updates it when it drifted.
+// An existing caBundle is kept when the desired configuration has none, so a CA injected by cert-manager survives,
+// and the desired labels are merged in, so labels set by others survive too.
+func registerWebhookConfiguration(ctx context.Context, client kubernetes.Interface, desired *admissionregistrationv1.MutatingWebhookConfiguration) error {
+	configurations := client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := configurations.Get(ctx, desired.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = configurations.Create(ctx, desired, metav1.CreateOptions{})
+			if err == nil {
+				slog.Info("Created MutatingWebhookConfiguration", "name", desired.Name)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		updated := existing.DeepCopy()
+		if updated.Labels == nil {
+			updated.Labels = map[string]string{}
+		}
+		for key, value := range desired.Labels {
+			updated.Labels[key] = value
+		}
+		updated.Webhooks = make([]admissionregistrationv1.MutatingWebhook, len(desired.Webhooks))
+		for i, webhook := range desired.Webhooks {
+			webhook = *webhook.DeepCopy()
+			if len(webhook.ClientConfig.CABundle) == 0 && i < len(existing.Webhooks) {
+				webhook.ClientConfig.CABundle = existing.Webhooks[i].ClientConfig.CABundle
+			}
+			updated.Webhooks[i] = webhook
+		}
+		if equality.Semantic.DeepEqual(existing.Labels, updated.Labels) && equality.Semantic.DeepEqual(existing.Webhooks, updated.Webhooks) {
+			return nil
+		}
+
+		_, err = configurations.Update(ctx, updated, metav1.UpdateOptions{})
+		if err == nil {
+			slog.Info("Updated MutatingWebhookConfiguration", "name", desired.Name)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not register MutatingWebhookConfiguration %s: %s", desired.Name, err.Error())
+	}
+	return nil
+}
+
+// unregisterWebhookConfiguration deletes the MutatingWebhookConfiguration, a missing configuration is not an error.
+func unregisterWebhookConfiguration(ctx context.Context, client kubernetes.Interface, name string) error {
+	err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Delete(ctx, name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not delete MutatingWebhookConfiguration %s: %s", name, err.Error())
+	}
+	slog.Info("Deleted MutatingWebhookConfiguration", "name", name)
+	return nil
+}
+
+// readCABundle reads the PEM encoded CA used for caBundle, an empty path returns no CA.
+func readCABundle(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	caBundle, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CA bundle: %s", err.Error())
+	}
+	return caBundle, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testWebhookParameters returns the parameters the webhook configuration tests register with.
+func testWebhookParameters() serverParameters {
+	return serverParameters{
+		serviceName:           "toleration-webhook",
+		serviceNamespace:      "toleration-webhook",
+		webhookConfigName:     "toleration-webhook",
+		webhookTimeoutSeconds: 10,
+		namespaceSelector:     "toleration-webhook=enabled",
+		objectSelector:        "app notin (excluded)",
+		failurePolicy:         "Ignore",
+	}
+}
+
+// TestBuildWebhookConfiguration tests the webhook configuration is built from the supported kinds and selectors.
+func TestBuildWebhookConfiguration(t *testing.T) {
+	configuration, err := buildWebhookConfiguration(testWebhookParameters(), []byte("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := configuration.Webhooks[0]
+	if webhook.Name != "toleration-webhook.toleration-webhook.svc.cluster.local" {
+		t.Errorf("Unexpected webhook name %s", webhook.Name)
+	}
+	resources := webhook.Rules[0].Resources
+	if len(resources) != len(supportedKinds) {
+		t.Errorf("Expected a rule for every supported kind, got %v", resources)
+	}
+	for i, supported := range supportedKinds {
+		if resources[i] != supported.resource {
+			t.Errorf("Expected resource %s, got %s", supported.resource, resources[i])
+		}
+	}
+	if webhook.ObjectSelector.MatchExpressions[0].Key != "app" || webhook.NamespaceSelector.MatchLabels["toleration-webhook"] != "enabled" {
+		t.Errorf("Unexpected selectors %v %v", webhook.NamespaceSelector, webhook.ObjectSelector)
+	}
+	if *webhook.TimeoutSeconds != 10 || *webhook.FailurePolicy != admissionregistrationv1.Ignore || *webhook.ClientConfig.Service.Path != webhookPath {
+		t.Errorf("Unexpected webhook settings %+v", webhook)
+	}
+
+	invalid := testWebhookParameters()
+	invalid.failurePolicy = "Sometimes"
+	if _, err := buildWebhookConfiguration(invalid, nil); err == nil {
+		t.Error("Expected an error for an invalid failure policy")
+	}
+}
+
+// TestRegisterWebhookConfiguration tests the webhook configuration is created, updated and deleted.
+func TestRegisterWebhookConfiguration(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	configurations := client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	ctx := context.Background()
+
+	desired, err := buildWebhookConfiguration(testWebhookParameters(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerWebhookConfiguration(ctx, client, desired); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a caBundle injected by cert-manager and a hand-edited rule.
+	existing, err := configurations.Get(ctx, "toleration-webhook", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected configuration to be created: %s", err.Error())
+	}
+	existing.Webhooks[0].ClientConfig.CABundle = []byte("injected-ca")
+	existing.Webhooks[0].Rules[0].Resources = []string{"deployments"}
+	if _, err := configurations.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registerWebhookConfiguration(ctx, client, desired); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := configurations.Get(ctx, "toleration-webhook", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Webhooks[0].Rules[0].Resources) != len(supportedKinds) {
+		t.Errorf("Expected drifted rules to be restored, got %v", updated.Webhooks[0].Rules[0].Resources)
+	}
+	if !bytes.Equal(updated.Webhooks[0].ClientConfig.CABundle, []byte("injected-ca")) {
+		t.Error("Expected the injected caBundle to be kept")
+	}
+
+	// A configuration read back from the API server, with a label added by someone else, has not drifted.
+	var stored admissionregistrationv1.MutatingWebhookConfiguration
+	raw, err := json.Marshal(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		t.Fatal(err)
+	}
+	stored.Labels["app.kubernetes.io/part-of"] = "platform"
+	if _, err := configurations.Update(ctx, &stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	actions := len(client.Actions())
+	if err := registerWebhookConfiguration(ctx, client, desired); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range client.Actions()[actions:] {
+		if action.GetVerb() == "update" {
+			t.Error("Expected an unchanged configuration not to be updated")
+		}
+	}
+
+	// Labels set by others are kept when the configuration drifted.
+	stored.Webhooks[0].Rules[0].Resources = []string{"deployments"}
+	if _, err := configurations.Update(ctx, &stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerWebhookConfiguration(ctx, client, desired); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err = configurations.Get(ctx, "toleration-webhook", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Labels["app.kubernetes.io/part-of"] != "platform" || updated.Labels["app.kubernetes.io/managed-by"] != "toleration-webhook" {
+		t.Errorf("Expected the desired labels to be merged in, got %v", updated.Labels)
+	}
+
+	if err := unregisterWebhookConfiguration(ctx, client, "toleration-webhook"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := configurations.Get(ctx, "toleration-webhook", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected configuration to be deleted, got %v", err)
+	}
+	if err := unregisterWebhookConfiguration(ctx, client, "toleration-webhook"); err != nil {
+		t.Errorf("Expected deleting a missing configuration to succeed, got %s", err.Error())
+	}
+}